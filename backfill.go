@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	bigqueryclient "db-sync/clients/bigquery"
+	"db-sync/clients/kiotviet"
+	"db-sync/clients/webdatabases"
+	"db-sync/config"
+	"db-sync/streaming"
+	"flag"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/civil"
+	log "github.com/sirupsen/logrus"
+)
+
+// runBackfill rebuilds the _date partitions of a table for a range of dates. Postgres tables only hold their current
+// rows, so only their partition of today can be rebuilt
+//
+//	db-sync backfill -table products -from 2022-07-01 -to 2022-07-03 [-pause 1m] [-state backfill_state.json]
+func runBackfill(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	tableName := flags.String("table", "", "BigQuery table to backfill")
+	fromFlag := flags.String("from", "", "first sync date to rebuild, YYYY-MM-DD")
+	toFlag := flags.String("to", "", "last sync date to rebuild, YYYY-MM-DD, the from date by default")
+	pause := flags.Duration("pause", 30*time.Second, "pause between two partitions")
+	statePath := flags.String("state", "backfill_state.json", "file recording the partitions already rebuilt, to resume an interrupted backfill")
+	if err := flags.Parse(args); err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	if *tableName == "" || *fromFlag == "" {
+		log.Errorln("backfill needs -table and -from")
+		return
+	}
+	from, err := civil.ParseDate(*fromFlag)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	to := from
+	if *toFlag != "" {
+		to, err = civil.ParseDate(*toFlag)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+
+	state, err := streaming.LoadBackfillState(*statePath)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	dbClient, err := webdatabases.NewClient()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	defer dbClient.Close()
+
+	bqClient, err := bigqueryclient.NewClient()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	defer bqClient.Close()
+	kiotvietClient, err := kiotviet.NewClient()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	batchSize, err := strconv.ParseInt(config.StreamingBatchSize, 10, 64)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	webDBDest, err := bigqueryclient.NewDestination(config.PipelineWebDB)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	kiotvietDest, err := bigqueryclient.NewDestination(config.PipelineKiotViet)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	tables := strings.Split(config.StreamingDbTables, config.Separator)
+	backfill := streaming.NewBackfill(bqClient, dbClient, kiotvietClient, webDBDest, kiotvietDest, batchSize, tables, *pause, state)
+	err = backfill.Backfill(ctx, *tableName, from, to)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"tableName": *tableName,
+			"state":     *statePath,
+			"error":     err,
+		}).Errorln("backfill stopped, run it again to resume")
+	} else {
+		log.WithFields(log.Fields{
+			"tableName": *tableName,
+			"from":      from,
+			"to":        to,
+		}).Infoln("done backfilling")
+	}
+	backfill.Summary().Log()
+}
@@ -2,16 +2,34 @@ package biqueryclient
 
 import (
 	"cloud.google.com/go/bigquery"
-	"cloud.google.com/go/civil"
 	"context"
 	"db-sync/config"
 	"db-sync/data"
+	"errors"
 	"fmt"
 	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
 type Client struct {
 	*bigquery.Client
+
+	writeMode      WriteMode
+	loadFileFormat LoadFileFormat
+	loadTempDir    string
+
+	deadLetter *deadLetterWriter
+
+	maximumBytesBilled int64
+
+	syncRuns *syncRunsTables
+}
+
+// WriteResult counts the rows of a Write call. Rejected rows were sent to the dead-letter destination
+type WriteResult struct {
+	Written  int64
+	Rejected int64
 }
 
 func NewClient() (*Client, error) {
@@ -21,56 +39,109 @@ func NewClient() (*Client, error) {
 		return nil, err
 	}
 
-	return &Client{bqClient}, nil
+	writeMode, err := parseWriteMode(config.BqWriteMode)
+	if err != nil {
+		return nil, err
+	}
+
+	loadFileFormat, err := parseLoadFileFormat(config.BqLoadFileFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	deadLetter, err := newDeadLetterWriter(config.BqDeadLetterDestination, config.BqDeadLetterDir)
+	if err != nil {
+		return nil, err
+	}
+
+	maximumBytesBilled, err := parseMaximumBytesBilled(config.BqMaximumBytesBilled)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		Client:             bqClient,
+		writeMode:          writeMode,
+		loadFileFormat:     loadFileFormat,
+		loadTempDir:        config.BqLoadTempDir,
+		deadLetter:         deadLetter,
+		maximumBytesBilled: maximumBytesBilled,
+		syncRuns:           &syncRunsTables{ensured: make(map[string]bool)},
+	}, nil
+}
+
+// Write sends rows stamped with the run into the presync table of the run destination using the write mode
+// the client was configured with: streaming inserts by default, or a load job from a local NDJSON/Avro file in load mode
+func (c *Client) Write(ctx context.Context, run *Run, tableName string, rows *data.Rows) (*WriteResult, error) {
+	if c.writeMode == WriteModeLoad {
+		return c.Load(ctx, run, tableName, rows)
+	}
+
+	return c.InsertOrUpdate(ctx, run, tableName, rows)
 }
 
-// CreateSyncTimePartitionTable creates 2 table into mainDataset and preSyncDataset
-// Tables in mainDataset will have _date field for partitioning
-// Tables in preDataset will have _date field and _created at field. Records are daily streamed into tables in the preDataset
-// then will be merged into table in the mainDataset
-func (c *Client) CreateSyncTimePartitionTable(ctx context.Context, mainDataset string, preSyncDataset string, tableName string, columns []data.Column) error {
-	schema := bigquery.Schema{&bigquery.FieldSchema{Name: "_date", Type: bigquery.DateFieldType}}
+// syncTableMetadata returns the expected metadata of the table in the main dataset and in the presync dataset.
+// The partitioning from the table options only applies to the main dataset, presync tables are always partitioned
+// by _date so their partitions expire and merges only scan the partition of the run
+func (c *Client) syncTableMetadata(dest *Destination, tableName string, columns []data.Column) (*bigquery.TableMetadata, *bigquery.TableMetadata, error) {
+	schema := bigquery.Schema{
+		&bigquery.FieldSchema{Name: "_date", Type: bigquery.DateFieldType},
+		&bigquery.FieldSchema{Name: "_run_id", Type: bigquery.StringFieldType},
+	}
 	coreSchema, err := c.convertColumnToSchema(columns)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	schema = append(schema, coreSchema...)
-	schema = append(schema)
-	metadata := &bigquery.TableMetadata{
-		TimePartitioning: &bigquery.TimePartitioning{
-			Field: "_date",
-		},
-		Schema: schema,
+	opts := dest.TableOptions(tableName)
+	description := opts.Description
+	if description == "" {
+		description = fmt.Sprintf("Daily snapshots of %s synced by db-sync", tableName)
 	}
 
-	tableRef := c.Dataset(mainDataset).Table(tableName)
-	if err := tableRef.Create(ctx, metadata); err != nil {
-		return err
+	schema = append(schema, coreSchema...)
+	createdAt := &bigquery.FieldSchema{Name: "_created_at", Type: bigquery.TimestampFieldType}
+	// the merges copy _created_at so the _latest views can order the versions of a row merged the same _date
+	mainSchema := append(append(bigquery.Schema{}, schema...), createdAt)
+	if opts.Strategy() == MergeStrategySCD2 {
+		mainSchema = append(mainSchema, SCD2Schema...)
+	}
+	timePartitioning, rangePartitioning := opts.partitioning()
+	metadata := &bigquery.TableMetadata{
+		Description:            description,
+		Labels:                 opts.Labels,
+		TimePartitioning:       timePartitioning,
+		RangePartitioning:      rangePartitioning,
+		Clustering:             opts.clustering(),
+		RequirePartitionFilter: opts.RequirePartitionFilter,
+		Schema:                 mainSchema,
 	}
 
-	// create table in the presync dataset
-	schema = append(schema, &bigquery.FieldSchema{Name: "_created_at", Type: bigquery.TimestampFieldType})
-	metadata = &bigquery.TableMetadata{
+	preSyncSchema := append(bigquery.Schema{}, schema...)
+	preSyncSchema = append(preSyncSchema, createdAt)
+	preSyncMetadata := &bigquery.TableMetadata{
+		Description: fmt.Sprintf("Rows of %s streamed by db-sync before being merged into the main dataset", tableName),
+		Labels:      opts.Labels,
 		TimePartitioning: &bigquery.TimePartitioning{
 			Field:      "_date",
-			Expiration: 7 * 24 * time.Hour, // expire after 7 days
+			Expiration: dest.PresyncExpiration,
 		},
-		Schema: schema,
-	}
-	preSyncTableRef := c.Dataset(preSyncDataset).Table(tableName)
-	if err := preSyncTableRef.Create(ctx, metadata); err != nil {
-		return err
+		Clustering:             opts.clustering(),
+		RequirePartitionFilter: opts.RequirePartitionFilter,
+		Schema:                 preSyncSchema,
 	}
 
-	return nil
+	return metadata, preSyncMetadata, nil
 }
 
-func (c *Client) InsertOrUpdate(ctx context.Context, dataset string, tableName string, rows *data.Rows) error {
+// InsertOrUpdate streams rows into the table. When BigQuery rejects some rows of the batch, rows which failed
+// for a transient reason are retried and the rows which are permanently rejected go to the dead-letter destination
+func (c *Client) InsertOrUpdate(ctx context.Context, run *Run, tableName string, rows *data.Rows) (*WriteResult, error) {
+	dataset := run.Dest.PresyncDataset
 	table := c.Dataset(dataset).Table(tableName)
 	metadata, err := table.Metadata(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	schema := metadata.Schema
@@ -78,26 +149,89 @@ func (c *Client) InsertOrUpdate(ctx context.Context, dataset string, tableName s
 	var vss []*bigquery.ValuesSaver
 
 	for _, r := range rows.Rows {
+		insertID, err := c.insertID(run, tableName, r)
+		if err != nil {
+			return nil, err
+		}
 		vss = append(vss, &bigquery.ValuesSaver{
-			Schema: schema,
-			Row:    c.convertToValue(r.Values, schema),
+			Schema:   schema,
+			InsertID: insertID,
+			Row:      c.convertToValue(r.Values, schema, run),
 		})
 	}
 
-	if err := inserter.Put(ctx, vss); err != nil {
-		return err
+	result := &WriteResult{}
+	pending := rows.Rows
+	for attempt := 1; len(vss) > 0; attempt++ {
+		err := c.putWithRetry(ctx, inserter, tableName, vss)
+		var putErrors bigquery.PutMultiError
+		if err != nil && !errors.As(err, &putErrors) {
+			return result, err
+		}
+
+		retryRows, retryVss, rejected := c.splitRowErrors(run, tableName, pending, vss, putErrors, attempt < maxRowAttempts)
+		result.Written += int64(len(vss) - len(retryVss) - len(rejected))
+		if len(rejected) > 0 {
+			result.Rejected += int64(len(rejected))
+			log.WithFields(log.Fields{
+				"tableName": tableName,
+				"rejected":  len(rejected),
+			}).Warnln("rows rejected by Bigquery, sending them to the dead-letter destination")
+			if err := c.deadLetter.write(ctx, c.Client, rejected); err != nil {
+				return result, err
+			}
+		}
+
+		pending, vss = retryRows, retryVss
+	}
+
+	return result, nil
+}
+
+// splitRowErrors separates the rows of a failed batch into the rows to retry and the permanently rejected ones.
+// Rows without errors were inserted
+func (c *Client) splitRowErrors(run *Run, tableName string, rows []data.Row, vss []*bigquery.ValuesSaver, putErrors bigquery.PutMultiError, canRetry bool) ([]data.Row, []*bigquery.ValuesSaver, []DeadLetterRecord) {
+	var retryRows []data.Row
+	var retryVss []*bigquery.ValuesSaver
+	var rejected []DeadLetterRecord
+	now := time.Now()
+	for _, rowErr := range putErrors {
+		if rowErr.RowIndex < 0 || rowErr.RowIndex >= len(rows) {
+			continue
+		}
+
+		rowErrors := toRowErrors(rowErr.Errors)
+		if canRetry && retriableRowErrors(rowErrors) {
+			retryRows = append(retryRows, rows[rowErr.RowIndex])
+			retryVss = append(retryVss, vss[rowErr.RowIndex])
+			continue
+		}
+
+		rejected = append(rejected, DeadLetterRecord{
+			RunID:      run.ID,
+			SyncDate:   run.SyncDate,
+			Dataset:    run.Dest.PresyncDataset,
+			Table:      tableName,
+			InsertID:   rowErr.InsertID,
+			Row:        rows[rowErr.RowIndex].Values,
+			Errors:     rowErrors,
+			RejectedAt: now,
+		})
 	}
 
-	return nil
+	return retryRows, retryVss, rejected
 }
 
-func (c *Client) convertToValue(row map[string]interface{}, schema bigquery.Schema) []bigquery.Value {
+func (c *Client) convertToValue(row map[string]interface{}, schema bigquery.Schema, run *Run) []bigquery.Value {
 	var values []bigquery.Value
 	for _, field := range schema {
 		if field.Name == "_date" {
-			values = append(values, civil.DateOf(time.Now()))
+			values = append(values, run.SyncDate)
+		} else if field.Name == "_run_id" {
+			values = append(values, run.ID)
 		} else if field.Name == "_created_at" {
-			values = append(values, civil.DateTimeOf(time.Now()))
+			// an instant in the timezone of the destination, whatever the timezone of the host
+			values = append(values, time.Now().In(run.Dest.Timezone))
 		} else {
 			values = append(values, row[field.Name])
 		}
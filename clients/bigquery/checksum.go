@@ -0,0 +1,94 @@
+package biqueryclient
+
+import (
+	"context"
+	"db-sync/data"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/iterator"
+)
+
+// SyncedRowsFilter selects the rows of the table in the main dataset which mirror the source after the merge of the run:
+// the current versions for scd2, the rows written by the run otherwise
+func (r *Run) SyncedRowsFilter(strategy MergeStrategy) string {
+	if strategy == MergeStrategySCD2 {
+		return QuoteIdentifier("_is_current")
+	}
+	return r.PartitionFilter()
+}
+
+// GetChecksum aggregates the rows synced by the run into the checksum compared with the source, see data.Checksum
+func (c *Client) GetChecksum(ctx context.Context, run *Run, tableName string, columns []data.Column, keyColumns []string) (*data.Checksum, error) {
+	sql, numerics, err := c.checksumQuery(run, tableName, columns, keyColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	q := c.Query(sql)
+	q.Location = run.Dest.Location
+	it, err := q.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var values []bigquery.Value
+	err = it.Next(&values)
+	if err == iterator.Done {
+		return nil, fmt.Errorf("checksum query of %s returned no row", tableName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	checksum := &data.Checksum{
+		Source:      data.SourceBQ,
+		Rows:        values[0].(int64),
+		KeyChecksum: values[1].(int64),
+		Columns:     make(map[string]data.ColumnChecksum),
+	}
+	i := 2
+	for n, column := range columns {
+		columnChecksum := data.ColumnChecksum{NonNull: values[i].(int64), Numeric: numerics[n]}
+		i++
+		if numerics[n] {
+			columnChecksum.Sum = values[i].(float64)
+			i++
+		}
+		checksum.Columns[column.Name] = columnChecksum
+	}
+	return checksum, nil
+}
+
+// checksumQuery returns the query computing the checksum and which columns are summed.
+// The aggregates are the ones webdatabases.Client.GetChecksum computes in Postgres
+func (c *Client) checksumQuery(run *Run, tableName string, columns []data.Column, keyColumns []string) (string, []bool, error) {
+	schema, err := c.convertColumnToSchema(columns)
+	if err != nil {
+		return "", nil, err
+	}
+
+	tableName = strings.ToLower(tableName)
+	var keys []string
+	for _, key := range keyColumns {
+		keys = append(keys, fmt.Sprintf("CAST(%s AS STRING)", QuoteIdentifier(key)))
+	}
+	aggregates := []string{
+		"COUNT(*)",
+		fmt.Sprintf("COALESCE(SUM(CAST(CONCAT('0x', SUBSTR(TO_HEX(MD5(ARRAY_TO_STRING([%s], '|'))), 1, 8)) AS INT64)), 0)", strings.Join(keys, ", ")),
+	}
+
+	numerics := make([]bool, len(schema))
+	for i, field := range schema {
+		aggregates = append(aggregates, fmt.Sprintf("COUNT(%s)", QuoteIdentifier(field.Name)))
+		if field.Type == bigquery.IntegerFieldType || field.Type == bigquery.FloatFieldType {
+			numerics[i] = true
+			aggregates = append(aggregates, fmt.Sprintf("CAST(COALESCE(SUM(%s), 0) AS FLOAT64)", QuoteIdentifier(field.Name)))
+		}
+	}
+
+	table := fmt.Sprintf("%s.%s", run.Dest.Dataset, tableName)
+	strategy := run.Dest.TableOptions(tableName).Strategy()
+	sql := fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(aggregates, ", "), QuoteIdentifier(table), run.SyncedRowsFilter(strategy))
+	return sql, numerics, nil
+}
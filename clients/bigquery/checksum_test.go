@@ -0,0 +1,30 @@
+package biqueryclient
+
+import (
+	"db-sync/data"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksumQuery(t *testing.T) {
+	assert := assert.New(t)
+	c := &Client{}
+	dest := &Destination{Dataset: "websync", Timezone: time.UTC, Tables: map[string]TableOptions{"products": {MergeStrategy: MergeStrategySCD2}}}
+	run := NewRun("run-1", dest)
+	columns := []data.Column{
+		{Name: "id", DataType: "INT8", From: data.ColumnFromBQ},
+		{Name: "name", DataType: "VARCHAR", NullAble: true, From: data.ColumnFromBQ},
+	}
+
+	sql, numerics, err := c.checksumQuery(run, "POptions", columns, []string{"id"})
+	assert.Nil(err)
+	assert.Equal([]bool{true, false}, numerics)
+	assert.Equal("SELECT COUNT(*), COALESCE(SUM(CAST(CONCAT('0x', SUBSTR(TO_HEX(MD5(ARRAY_TO_STRING([CAST(`id` AS STRING)], '|'))), 1, 8)) AS INT64)), 0), "+
+		"COUNT(`id`), CAST(COALESCE(SUM(`id`), 0) AS FLOAT64), COUNT(`name`) FROM `websync.poptions` WHERE "+run.PartitionFilter(), sql)
+
+	sql, _, err = c.checksumQuery(run, "products", columns, []string{"id"})
+	assert.Nil(err)
+	assert.Contains(sql, "FROM `websync.products` WHERE `_is_current`")
+}
@@ -0,0 +1,91 @@
+package biqueryclient
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"cloud.google.com/go/bigquery"
+	log "github.com/sirupsen/logrus"
+)
+
+// MergeCost is what a merge scans according to its dry run and, when it was executed, what it was billed
+type MergeCost struct {
+	Table          string
+	JobID          string
+	BytesProcessed int64
+	BytesBilled    int64
+	Executed       bool
+}
+
+func parseMaximumBytesBilled(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	maximumBytesBilled, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || maximumBytesBilled < 0 {
+		return 0, fmt.Errorf("invalid maximum bytes billed %s", value)
+	}
+	return maximumBytesBilled, nil
+}
+
+// RunMerge submits the merge statement as a dry run first and logs its estimate. Unless the run is a dry run,
+// the merge is then executed with the MaximumBytesBilled cap of the client, BigQuery fails the job instead of going over it
+func (c *Client) RunMerge(ctx context.Context, run *Run, stmt MergeStatement) (*MergeCost, error) {
+	sql, err := stmt.SQL()
+	if err != nil {
+		return nil, err
+	}
+
+	cost := &MergeCost{Table: stmt.Table}
+	q := c.Query(sql)
+	q.Location = run.Dest.Location
+	q.DryRun = true
+	job, err := q.Run(ctx)
+	if err != nil {
+		return cost, err
+	}
+	if status := job.LastStatus(); status != nil && status.Statistics != nil {
+		cost.BytesProcessed = status.Statistics.TotalBytesProcessed
+	}
+
+	logEntry := log.WithFields(log.Fields{
+		"tableName":          stmt.Table,
+		"strategy":           stmt.Strategy,
+		"bytesProcessed":     cost.BytesProcessed,
+		"maximumBytesBilled": c.maximumBytesBilled,
+	})
+	if c.maximumBytesBilled > 0 && cost.BytesProcessed > c.maximumBytesBilled {
+		logEntry.Warnln("merge estimate is over the maximum bytes billed, the merge job will fail")
+	} else {
+		logEntry.Infoln("merge estimate")
+	}
+	if run.DryRun {
+		return cost, nil
+	}
+
+	q = c.Query(sql)
+	q.Location = run.Dest.Location
+	q.MaxBytesBilled = c.maximumBytesBilled
+	job, err = q.Run(ctx)
+	if err != nil {
+		return cost, err
+	}
+	cost.JobID = job.ID()
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return cost, err
+	}
+	if err := status.Err(); err != nil {
+		return cost, err
+	}
+
+	cost.Executed = true
+	if status.Statistics != nil {
+		if details, ok := status.Statistics.Details.(*bigquery.QueryStatistics); ok {
+			cost.BytesBilled = details.TotalBytesBilled
+		}
+	}
+	return cost, nil
+}
@@ -0,0 +1,24 @@
+package biqueryclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMaximumBytesBilled(t *testing.T) {
+	assert := assert.New(t)
+
+	maximumBytesBilled, err := parseMaximumBytesBilled("")
+	assert.Nil(err)
+	assert.Equal(int64(0), maximumBytesBilled)
+
+	maximumBytesBilled, err = parseMaximumBytesBilled("10737418240")
+	assert.Nil(err)
+	assert.Equal(int64(10737418240), maximumBytesBilled)
+
+	_, err = parseMaximumBytesBilled("10GB")
+	assert.NotNil(err)
+	_, err = parseMaximumBytesBilled("-1")
+	assert.NotNil(err)
+}
@@ -0,0 +1,422 @@
+package biqueryclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/iterator"
+)
+
+type DeadLetterDestination string
+
+const (
+	DeadLetterDestinationLog   DeadLetterDestination = "log"
+	DeadLetterDestinationFile  DeadLetterDestination = "file"
+	DeadLetterDestinationTable DeadLetterDestination = "table"
+)
+
+// DeadLetterTable is created in the dataset of the rejected rows when the destination is a BigQuery table
+const DeadLetterTable = "_dead_letter"
+
+// DeadLetterReplaysTable records the rows of DeadLetterTable already replayed, so they are not replayed again
+const DeadLetterReplaysTable = "_dead_letter_replays"
+
+// DefaultDeadLetterDir is used by the file destination when no directory is configured
+const DefaultDeadLetterDir = "dead_letter"
+
+// maxRowAttempts is the number of times a row failing for a retriable reason is sent before being dead-lettered
+const maxRowAttempts = 3
+
+// retriableRowReasons are the row error reasons which don't come from the row itself.
+// "stopped" means the row was valid but the batch was stopped because of other invalid rows
+var retriableRowReasons = map[string]struct{}{
+	"stopped":       {},
+	"backendError":  {},
+	"internalError": {},
+	"timeout":       {},
+}
+
+type RowError struct {
+	Reason   string `json:"reason"`
+	Location string `json:"location"`
+	Message  string `json:"message"`
+}
+
+// DeadLetterRecord is a row permanently rejected by BigQuery. Row holds the values as they were read from the source
+type DeadLetterRecord struct {
+	RunID string `json:"run_id"`
+	// SyncDate is the _date of the run, the row is replayed into this partition
+	SyncDate   civil.Date             `json:"sync_date"`
+	Dataset    string                 `json:"dataset"`
+	Table      string                 `json:"table"`
+	InsertID   string                 `json:"insert_id"`
+	Row        map[string]interface{} `json:"row"`
+	Errors     []RowError             `json:"errors"`
+	RejectedAt time.Time              `json:"rejected_at"`
+}
+
+var deadLetterSchema = bigquery.Schema{
+	{Name: "run_id", Type: bigquery.StringFieldType, Required: true},
+	{Name: "dataset", Type: bigquery.StringFieldType, Required: true},
+	{Name: "table_name", Type: bigquery.StringFieldType, Required: true},
+	{Name: "insert_id", Type: bigquery.StringFieldType},
+	{Name: "row", Type: bigquery.StringFieldType, Description: "row values in JSON"},
+	{Name: "errors", Type: bigquery.StringFieldType, Description: "row errors in JSON"},
+	{Name: "rejected_at", Type: bigquery.TimestampFieldType, Required: true},
+	{Name: "sync_date", Type: bigquery.DateFieldType, Description: "_date of the run which rejected the row"},
+}
+
+var deadLetterTableMetadata = &bigquery.TableMetadata{
+	Description: "Rows rejected by Bigquery during db-sync streaming inserts",
+	TimePartitioning: &bigquery.TimePartitioning{
+		Field: "rejected_at",
+	},
+	Schema: deadLetterSchema,
+}
+
+var deadLetterReplaysSchema = bigquery.Schema{
+	{Name: "run_id", Type: bigquery.StringFieldType, Required: true},
+	{Name: "table_name", Type: bigquery.StringFieldType, Required: true},
+	{Name: "insert_id", Type: bigquery.StringFieldType},
+	{Name: "rejected_at", Type: bigquery.TimestampFieldType, Required: true},
+	{Name: "replay_run_id", Type: bigquery.StringFieldType, Required: true},
+	{Name: "replayed_at", Type: bigquery.TimestampFieldType, Required: true},
+}
+
+var deadLetterReplaysTableMetadata = &bigquery.TableMetadata{
+	Description: "Rows of _dead_letter replayed by db-sync replay",
+	TimePartitioning: &bigquery.TimePartitioning{
+		Field: "replayed_at",
+	},
+	Schema: deadLetterReplaysSchema,
+}
+
+type deadLetterWriter struct {
+	destination DeadLetterDestination
+	dir         string
+
+	lock sync.Mutex
+	// ensuredTable is keyed by dataset.table
+	ensuredTable map[string]bool
+}
+
+func newDeadLetterWriter(destination string, dir string) (*deadLetterWriter, error) {
+	w := &deadLetterWriter{
+		destination:  DeadLetterDestination(destination),
+		dir:          dir,
+		ensuredTable: make(map[string]bool),
+	}
+	switch w.destination {
+	case "":
+		w.destination = DeadLetterDestinationLog
+	case DeadLetterDestinationLog, DeadLetterDestinationTable:
+	case DeadLetterDestinationFile:
+		if w.dir == "" {
+			w.dir = DefaultDeadLetterDir
+		}
+		if err := os.MkdirAll(w.dir, 0755); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("dead-letter destination %s not supported yet", destination)
+	}
+
+	return w, nil
+}
+
+// Key identifies the record among the records of its table
+func (r DeadLetterRecord) Key() string {
+	return fmt.Sprintf("%s/%s/%s/%d", r.RunID, r.Table, r.InsertID, r.RejectedAt.UnixNano())
+}
+
+// DeadLetterFile is the NDJSON file the rejected rows of a table are appended to
+func DeadLetterFile(dir string, dataset string, tableName string) string {
+	return filepath.Join(dir, fmt.Sprintf("%s.%s.ndjson", dataset, tableName))
+}
+
+func (w *deadLetterWriter) write(ctx context.Context, bqClient *bigquery.Client, records []DeadLetterRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	switch w.destination {
+	case DeadLetterDestinationFile:
+		return w.writeFile(records)
+	case DeadLetterDestinationTable:
+		return w.writeTable(ctx, bqClient, records)
+	}
+
+	for _, record := range records {
+		log.WithFields(log.Fields{
+			"tableName": fmt.Sprintf("%s.%s", record.Dataset, record.Table),
+			"insertID":  record.InsertID,
+			"row":       record.Row,
+			"errors":    record.Errors,
+		}).Errorln("row rejected by Bigquery")
+	}
+	return nil
+}
+
+func (w *deadLetterWriter) writeFile(records []DeadLetterRecord) error {
+	// batches of the same table are inserted concurrently
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	f, err := os.OpenFile(DeadLetterFile(w.dir, records[0].Dataset, records[0].Table), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *deadLetterWriter) writeTable(ctx context.Context, bqClient *bigquery.Client, records []DeadLetterRecord) error {
+	dataset := records[0].Dataset
+	table := bqClient.Dataset(dataset).Table(DeadLetterTable)
+	if err := w.ensureTable(ctx, table, deadLetterTableMetadata); err != nil {
+		return err
+	}
+
+	var vss []*bigquery.ValuesSaver
+	for _, record := range records {
+		row, err := json.Marshal(record.Row)
+		if err != nil {
+			return err
+		}
+		rowErrors, err := json.Marshal(record.Errors)
+		if err != nil {
+			return err
+		}
+		vss = append(vss, &bigquery.ValuesSaver{
+			Schema:   deadLetterSchema,
+			InsertID: record.InsertID,
+			Row: []bigquery.Value{
+				record.RunID, record.Dataset, record.Table, record.InsertID, string(row), string(rowErrors), record.RejectedAt, record.SyncDate,
+			},
+		})
+	}
+
+	return table.Inserter().Put(ctx, vss)
+}
+
+// ensureTable creates the table, or adds the columns of metadata missing from the existing table
+func (w *deadLetterWriter) ensureTable(ctx context.Context, table *bigquery.Table, metadata *bigquery.TableMetadata) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	fullTableName := table.DatasetID + "." + table.TableID
+	if w.ensuredTable[fullTableName] {
+		return nil
+	}
+
+	existing, err := table.Metadata(ctx)
+	if isNotFound(err) {
+		err = table.Create(ctx, metadata)
+	} else if err == nil {
+		newSchema, changes := diffSchema(existing.Schema, metadata.Schema)
+		if len(changes) > 0 {
+			_, err = table.Update(ctx, bigquery.TableMetadataToUpdate{Schema: newSchema}, existing.ETag)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	w.ensuredTable[fullTableName] = true
+	return nil
+}
+
+func toRowErrors(errs bigquery.MultiError) []RowError {
+	var rowErrors []RowError
+	for _, err := range errs {
+		if bqErr, ok := err.(*bigquery.Error); ok {
+			rowErrors = append(rowErrors, RowError{Reason: bqErr.Reason, Location: bqErr.Location, Message: bqErr.Message})
+		} else {
+			rowErrors = append(rowErrors, RowError{Message: err.Error()})
+		}
+	}
+	return rowErrors
+}
+
+func retriableRowErrors(rowErrors []RowError) bool {
+	if len(rowErrors) == 0 {
+		return false
+	}
+	for _, rowErr := range rowErrors {
+		if _, ok := retriableRowReasons[rowErr.Reason]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadDeadLetterFile reads the records appended to a dead-letter NDJSON file
+func ReadDeadLetterFile(path string) ([]DeadLetterRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []DeadLetterRecord
+	decoder := json.NewDecoder(f)
+	for decoder.More() {
+		var record DeadLetterRecord
+		if err := decoder.Decode(&record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// WriteDeadLetterFile replaces the content of a dead-letter file with the records, the file is removed when there
+// are none
+func WriteDeadLetterFile(path string, records []DeadLetterRecord) error {
+	if len(records) == 0 {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	// written then renamed so an interrupted write never loses records
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadDeadLetterTable reads the records of the dead-letter table in the presync dataset of the destination which
+// were not replayed yet. tableName and runID are optional filters
+func (c *Client) ReadDeadLetterTable(ctx context.Context, dest *Destination, tableName string, runID string) ([]DeadLetterRecord, error) {
+	dataset := dest.PresyncDataset
+	// the tables are created when missing so the query doesn't fail before the first rejected row
+	if err := c.deadLetter.ensureTable(ctx, c.Dataset(dataset).Table(DeadLetterTable), deadLetterTableMetadata); err != nil {
+		return nil, err
+	}
+	if err := c.deadLetter.ensureTable(ctx, c.Dataset(dataset).Table(DeadLetterReplaysTable), deadLetterReplaysTableMetadata); err != nil {
+		return nil, err
+	}
+
+	q := c.Query(fmt.Sprintf("SELECT run_id, dataset, table_name, insert_id, `row`, errors, rejected_at, sync_date FROM `%s.%s` AS d "+
+		"WHERE (@table_name = '' OR table_name = @table_name) AND (@run_id = '' OR run_id = @run_id) "+
+		"AND NOT EXISTS (SELECT 1 FROM `%s.%s` AS r WHERE r.run_id = d.run_id AND r.table_name = d.table_name "+
+		"AND IFNULL(r.insert_id, '') = IFNULL(d.insert_id, '') AND r.rejected_at = d.rejected_at)",
+		dataset, DeadLetterTable, dataset, DeadLetterReplaysTable))
+	q.Parameters = []bigquery.QueryParameter{
+		{Name: "table_name", Value: tableName},
+		{Name: "run_id", Value: runID},
+	}
+	q.Location = dest.Location
+
+	it, err := q.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []DeadLetterRecord
+	for {
+		var row struct {
+			RunID      string              `bigquery:"run_id"`
+			Dataset    string              `bigquery:"dataset"`
+			Table      string              `bigquery:"table_name"`
+			InsertID   bigquery.NullString `bigquery:"insert_id"`
+			Row        bigquery.NullString `bigquery:"row"`
+			Errors     bigquery.NullString `bigquery:"errors"`
+			RejectedAt time.Time           `bigquery:"rejected_at"`
+			SyncDate   bigquery.NullDate   `bigquery:"sync_date"`
+		}
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		record := DeadLetterRecord{
+			RunID:      row.RunID,
+			Dataset:    row.Dataset,
+			Table:      row.Table,
+			InsertID:   row.InsertID.StringVal,
+			RejectedAt: row.RejectedAt,
+			SyncDate:   row.SyncDate.Date,
+		}
+		if err := json.Unmarshal([]byte(row.Row.StringVal), &record.Row); err != nil {
+			return nil, err
+		}
+		if row.Errors.Valid {
+			if err := json.Unmarshal([]byte(row.Errors.StringVal), &record.Errors); err != nil {
+				return nil, err
+			}
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// MarkDeadLetterReplayed records the rows of the dead-letter tables replayed by the replay run
+func (c *Client) MarkDeadLetterReplayed(ctx context.Context, replayRunID string, records []DeadLetterRecord) error {
+	datasetRecords := make(map[string][]DeadLetterRecord)
+	var datasets []string
+	for _, record := range records {
+		if _, ok := datasetRecords[record.Dataset]; !ok {
+			datasets = append(datasets, record.Dataset)
+		}
+		datasetRecords[record.Dataset] = append(datasetRecords[record.Dataset], record)
+	}
+
+	now := time.Now()
+	for _, dataset := range datasets {
+		table := c.Dataset(dataset).Table(DeadLetterReplaysTable)
+		if err := c.deadLetter.ensureTable(ctx, table, deadLetterReplaysTableMetadata); err != nil {
+			return err
+		}
+
+		var vss []*bigquery.ValuesSaver
+		for _, record := range datasetRecords[dataset] {
+			vss = append(vss, &bigquery.ValuesSaver{
+				Schema:   deadLetterReplaysSchema,
+				InsertID: replayRunID + "/" + record.Key(),
+				Row: []bigquery.Value{
+					record.RunID, record.Table, record.InsertID, record.RejectedAt, replayRunID, now,
+				},
+			})
+		}
+		if err := table.Inserter().Put(ctx, vss); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package biqueryclient
+
+import (
+	"bufio"
+	"context"
+	"db-sync/data"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitRowErrors(t *testing.T) {
+	assert := assert.New(t)
+	c := &Client{}
+	run := &Run{ID: "run-1", Dest: &Destination{PresyncDataset: "presync"}}
+	rows := []data.Row{
+		{Values: map[string]interface{}{"id": 1}},
+		{Values: map[string]interface{}{"id": 2}},
+		{Values: map[string]interface{}{"id": 3}},
+	}
+	vss := []*bigquery.ValuesSaver{{InsertID: "a"}, {InsertID: "b"}, {InsertID: "c"}}
+	putErrors := bigquery.PutMultiError{
+		{InsertID: "b", RowIndex: 1, Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Location: "price", Message: "bad float"}}},
+		{InsertID: "c", RowIndex: 2, Errors: bigquery.MultiError{&bigquery.Error{Reason: "stopped"}}},
+	}
+
+	retryRows, retryVss, rejected := c.splitRowErrors(run, "products", rows, vss, putErrors, true)
+	assert.Equal([]data.Row{rows[2]}, retryRows)
+	assert.Equal("c", retryVss[0].InsertID)
+	assert.Len(rejected, 1)
+	assert.Equal("b", rejected[0].InsertID)
+	assert.Equal([]RowError{{Reason: "invalid", Location: "price", Message: "bad float"}}, rejected[0].Errors)
+
+	_, _, rejected = c.splitRowErrors(run, "products", rows, vss, putErrors, false)
+	assert.Len(rejected, 2)
+}
+
+func TestDeadLetterFile(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	w, err := newDeadLetterWriter("file", dir)
+	assert.Nil(err)
+
+	record := DeadLetterRecord{RunID: "run-1", SyncDate: civil.Date{Year: 2022, Month: 7, Day: 1}, Dataset: "presync", Table: "products", Row: map[string]interface{}{"id": float64(1)}}
+	assert.Nil(w.write(context.Background(), nil, []DeadLetterRecord{record}))
+	assert.Nil(w.write(context.Background(), nil, []DeadLetterRecord{record}))
+
+	f, err := os.Open(DeadLetterFile(dir, "presync", "products"))
+	assert.Nil(err)
+	defer f.Close()
+	var lines int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var read DeadLetterRecord
+		assert.Nil(json.Unmarshal(scanner.Bytes(), &read))
+		assert.Equal(record.Row, read.Row)
+		assert.Equal(record.SyncDate, read.SyncDate)
+		lines++
+	}
+	assert.Equal(2, lines)
+}
+
+func TestWriteDeadLetterFile(t *testing.T) {
+	assert := assert.New(t)
+	path := DeadLetterFile(t.TempDir(), "presync", "products")
+	records := []DeadLetterRecord{
+		{RunID: "run-1", SyncDate: civil.Date{Year: 2022, Month: 7, Day: 1}, Table: "products", InsertID: "a"},
+		{RunID: "run-1", SyncDate: civil.Date{Year: 2022, Month: 7, Day: 1}, Table: "products", InsertID: "b"},
+	}
+
+	assert.Nil(WriteDeadLetterFile(path, records))
+	read, err := ReadDeadLetterFile(path)
+	assert.Nil(err)
+	assert.Equal(records[1].Key(), read[1].Key())
+	assert.NotEqual(read[0].Key(), read[1].Key())
+
+	assert.Nil(WriteDeadLetterFile(path, nil))
+	_, err = os.Stat(path)
+	assert.True(os.IsNotExist(err))
+	assert.Nil(WriteDeadLetterFile(path, nil))
+}
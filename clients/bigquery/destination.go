@@ -0,0 +1,72 @@
+package biqueryclient
+
+import (
+	"db-sync/config"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultLocation          = "US"
+	DefaultSyncTimezone      = "Asia/Ho_Chi_Minh"
+	DefaultPresyncExpiration = 7 * 24 * time.Hour
+)
+
+// Destination holds the BigQuery settings of a pipeline. They are shared by table creation, row stamping and merges
+type Destination struct {
+	// Dataset is the websync dataset rows are merged into
+	Dataset        string
+	PresyncDataset string
+	Location       string
+	Timezone       *time.Location
+	// PresyncExpiration is the partition expiration of the presync tables
+	PresyncExpiration time.Duration
+	Tables            map[string]TableOptions
+}
+
+// NewDestination reads the destination of the pipeline from the config, see config.PipelineSetting
+func NewDestination(pipeline string) (*Destination, error) {
+	location := config.PipelineSetting(pipeline, "BQ_LOCATION", config.BqLocation)
+	if location == "" {
+		location = DefaultLocation
+	}
+
+	timezone := config.PipelineSetting(pipeline, "SYNC_TIMEZONE", config.SyncTimezone)
+	if timezone == "" {
+		timezone = DefaultSyncTimezone
+	}
+	tz, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	expiration := DefaultPresyncExpiration
+	expirationDays := config.PipelineSetting(pipeline, "BQ_PRESYNC_EXPIRATION_DAYS", config.BqPresyncExpirationDays)
+	if expirationDays != "" {
+		days, err := strconv.Atoi(expirationDays)
+		if err != nil {
+			return nil, fmt.Errorf("invalid presync expiration days %s: %v", expirationDays, err)
+		}
+		expiration = time.Duration(days) * 24 * time.Hour
+	}
+
+	tables, err := LoadTableOptions(config.PipelineSetting(pipeline, "BQ_TABLE_OPTIONS_FILE", config.BqTableOptionsFile))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Destination{
+		Dataset:           config.PipelineSetting(pipeline, "BQ_WEBSYNC_DATASET", config.BqWebsyncDataset),
+		PresyncDataset:    config.PipelineSetting(pipeline, "BQ_PRESYNC_DATASET", config.BqPresyncDataset),
+		Location:          location,
+		Timezone:          tz,
+		PresyncExpiration: expiration,
+		Tables:            tables,
+	}, nil
+}
+
+// TableOptions returns the options of the table, the zero value if it has none
+func (d *Destination) TableOptions(tableName string) TableOptions {
+	return d.Tables[tableName]
+}
@@ -0,0 +1,28 @@
+package biqueryclient
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDestination(t *testing.T) {
+	assert := assert.New(t)
+	os.Setenv("KIOTVIET_BQ_LOCATION", "asia-southeast1")
+	os.Setenv("KIOTVIET_BQ_PRESYNC_EXPIRATION_DAYS", "3")
+	defer os.Unsetenv("KIOTVIET_BQ_LOCATION")
+	defer os.Unsetenv("KIOTVIET_BQ_PRESYNC_EXPIRATION_DAYS")
+
+	dest, err := NewDestination("KIOTVIET")
+	assert.Nil(err)
+	assert.Equal("asia-southeast1", dest.Location)
+	assert.Equal(3*24*time.Hour, dest.PresyncExpiration)
+	assert.Equal("Asia/Ho_Chi_Minh", dest.Timezone.String())
+
+	dest, err = NewDestination("WEBDB")
+	assert.Nil(err)
+	assert.Equal(DefaultLocation, dest.Location)
+	assert.Equal(DefaultPresyncExpiration, dest.PresyncExpiration)
+}
@@ -0,0 +1,95 @@
+package biqueryclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"db-sync/data"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	maxPutAttempts  = 5
+	putRetryBackoff = time.Second
+)
+
+// insertID returns a deterministic insert ID for the row so a retried Put of the same batch in the same run
+// is deduplicated by BigQuery instead of duplicating rows in the presync table. The ID hashes the whole row,
+// which holds the key columns of the table whatever they are
+func (c *Client) insertID(run *Run, tableName string, row data.Row) (string, error) {
+	rowJSON, err := json.Marshal(row.Values)
+	if err != nil {
+		return "", err
+	}
+	rowHash := sha256.Sum256(rowJSON)
+
+	h := sha256.New()
+	for _, part := range []string{run.ID, tableName, hex.EncodeToString(rowHash[:])} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+
+	// BigQuery insert IDs are limited to 128 characters
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// putWithRetry retries transient Put failures (timeouts, 5xx, rate limiting) with exponential backoff.
+// Insert IDs are kept between attempts so rows which went through in a failed attempt are not duplicated
+func (c *Client) putWithRetry(ctx context.Context, inserter *bigquery.Inserter, tableName string, vss []*bigquery.ValuesSaver) error {
+	var err error
+	backoff := putRetryBackoff
+	for attempt := 1; attempt <= maxPutAttempts; attempt++ {
+		err = inserter.Put(ctx, vss)
+		if err == nil || !isTransientError(err) || attempt == maxPutAttempts {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"tableName": tableName,
+			"attempt":   attempt,
+			"error":     err,
+		}).Warnln("transient error inserting rows into Bigquery, retrying")
+
+		sleep := backoff + time.Duration(rand.Int63n(int64(backoff)))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(sleep):
+		}
+		backoff *= 2
+	}
+
+	return err
+}
+
+func isTransientError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+
+	return false
+}
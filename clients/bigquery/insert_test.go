@@ -0,0 +1,60 @@
+package biqueryclient
+
+import (
+	"db-sync/data"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertID(t *testing.T) {
+	assert := assert.New(t)
+	c := &Client{}
+	run := &Run{ID: "run-1"}
+	row := data.Row{Values: map[string]interface{}{"id": 1, "_sub_id": 2, "name": "giakho"}}
+
+	id, err := c.insertID(run, "kiotviet_transfers", row)
+	assert.Nil(err)
+	sameID, err := c.insertID(run, "kiotviet_transfers", data.Row{Values: map[string]interface{}{"name": "giakho", "_sub_id": 2, "id": 1}})
+	assert.Nil(err)
+	assert.Equal(id, sameID)
+	assert.LessOrEqual(len(id), 128)
+
+	otherTable, _ := c.insertID(run, "products", row)
+	assert.NotEqual(id, otherTable)
+
+	otherRun, _ := c.insertID(&Run{ID: "run-2"}, "kiotviet_transfers", row)
+	assert.NotEqual(id, otherRun)
+
+	changedRow, _ := c.insertID(run, "kiotviet_transfers", data.Row{Values: map[string]interface{}{"id": 1, "_sub_id": 2, "name": "gia kho"}})
+	assert.NotEqual(id, changedRow)
+
+	inventory, _ := c.insertID(run, "kiotviet_inventories", data.Row{Values: map[string]interface{}{"product_id": 1, "branch_id": 1, "on_hand": 3}})
+	otherBranch, _ := c.insertID(run, "kiotviet_inventories", data.Row{Values: map[string]interface{}{"product_id": 1, "branch_id": 2, "on_hand": 3}})
+	assert.NotEqual(inventory, otherBranch)
+}
+
+func TestConvertToValue(t *testing.T) {
+	assert := assert.New(t)
+	c := &Client{}
+	timezone, err := time.LoadLocation("Asia/Ho_Chi_Minh")
+	assert.Nil(err)
+	run := &Run{ID: "run-1", Dest: &Destination{Timezone: timezone}, SyncDate: civil.Date{Year: 2022, Month: 7, Day: 1}}
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.IntegerFieldType},
+		{Name: "_date", Type: bigquery.DateFieldType},
+		{Name: "_run_id", Type: bigquery.StringFieldType},
+		{Name: "_created_at", Type: bigquery.TimestampFieldType},
+	}
+
+	before := time.Now()
+	values := c.convertToValue(map[string]interface{}{"id": 1}, schema, run)
+	assert.Equal([]bigquery.Value{1, run.SyncDate, "run-1"}, values[:3])
+	createdAt, ok := values[3].(time.Time)
+	assert.True(ok)
+	assert.Equal(timezone, createdAt.Location())
+	assert.False(createdAt.Before(before))
+}
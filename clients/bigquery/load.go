@@ -0,0 +1,315 @@
+package biqueryclient
+
+import (
+	"bufio"
+	"context"
+	"db-sync/data"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"github.com/linkedin/goavro/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+type WriteMode string
+
+const (
+	WriteModeStreaming WriteMode = "streaming"
+	WriteModeLoad      WriteMode = "load"
+)
+
+type LoadFileFormat string
+
+const (
+	LoadFileFormatNDJSON LoadFileFormat = "ndjson"
+	LoadFileFormatAvro   LoadFileFormat = "avro"
+)
+
+const bqTimestampLayout = "2006-01-02 15:04:05.999999 UTC"
+
+func parseWriteMode(mode string) (WriteMode, error) {
+	switch WriteMode(mode) {
+	case "", WriteModeStreaming:
+		return WriteModeStreaming, nil
+	case WriteModeLoad:
+		return WriteModeLoad, nil
+	}
+
+	return "", fmt.Errorf("write mode %s not supported yet", mode)
+}
+
+func parseLoadFileFormat(format string) (LoadFileFormat, error) {
+	switch LoadFileFormat(format) {
+	case "", LoadFileFormatNDJSON:
+		return LoadFileFormatNDJSON, nil
+	case LoadFileFormatAvro:
+		return LoadFileFormatAvro, nil
+	}
+
+	return "", fmt.Errorf("load file format %s not supported yet", format)
+}
+
+// Load serializes rows into a local NDJSON or Avro file and appends them to the table with a load job.
+// Unlike streaming inserts, loaded rows are immediately available for DML and do not count towards streaming quotas
+func (c *Client) Load(ctx context.Context, run *Run, tableName string, rows *data.Rows) (*WriteResult, error) {
+	dataset := run.Dest.PresyncDataset
+	table := c.Dataset(dataset).Table(tableName)
+	metadata, err := table.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.CreateTemp(c.loadTempDir, fmt.Sprintf("%s-*.%s", tableName, c.loadFileFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	logEntry := log.WithFields(log.Fields{
+		"tableName": fmt.Sprintf("%s.%s", dataset, tableName),
+		"file":      f.Name(),
+		"rows":      len(rows.Rows),
+	})
+
+	var sourceFormat bigquery.DataFormat
+	switch c.loadFileFormat {
+	case LoadFileFormatAvro:
+		sourceFormat = bigquery.Avro
+		err = c.writeAvro(f, metadata.Schema, rows, run)
+	default:
+		sourceFormat = bigquery.JSON
+		err = c.writeNDJSON(f, metadata.Schema, rows, run)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+
+	source := bigquery.NewReaderSource(f)
+	source.SourceFormat = sourceFormat
+	loader := table.LoaderFrom(source)
+	loader.WriteDisposition = bigquery.WriteAppend
+	loader.CreateDisposition = bigquery.CreateNever
+	loader.UseAvroLogicalTypes = true
+	loader.Location = run.Dest.Location
+
+	job, err := loader.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := status.Err(); err != nil {
+		return nil, err
+	}
+
+	logEntry.WithField("jobID", job.ID()).Infoln("done loading rows into Bigquery")
+	return &WriteResult{Written: int64(len(rows.Rows))}, nil
+}
+
+func (c *Client) writeNDJSON(f *os.File, schema bigquery.Schema, rows *data.Rows, run *Run) error {
+	w := bufio.NewWriter(f)
+	encoder := json.NewEncoder(w)
+	for _, r := range rows.Rows {
+		values := c.convertToValue(r.Values, schema, run)
+		record := make(map[string]interface{}, len(schema))
+		for i, field := range schema {
+			record[field.Name] = toJSONValue(values[i])
+		}
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+func (c *Client) writeAvro(f *os.File, schema bigquery.Schema, rows *data.Rows, run *Run) error {
+	avroSchema, err := schemaToAvro(schema)
+	if err != nil {
+		return err
+	}
+
+	codec, err := goavro.NewCodec(avroSchema)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	ocfWriter, err := goavro.NewOCFWriter(goavro.OCFConfig{
+		W:     w,
+		Codec: codec,
+	})
+	if err != nil {
+		return err
+	}
+
+	var records []interface{}
+	for _, r := range rows.Rows {
+		values := c.convertToValue(r.Values, schema, run)
+		record := make(map[string]interface{}, len(schema))
+		for i, field := range schema {
+			record[field.Name] = toAvroValue(field, values[i])
+		}
+		records = append(records, record)
+	}
+
+	if err := ocfWriter.Append(records); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// schemaToAvro builds an Avro record schema equivalent to the BigQuery table schema.
+// Nullable columns become a union with null
+func schemaToAvro(schema bigquery.Schema) (string, error) {
+	var fields []map[string]interface{}
+	for _, field := range schema {
+		var avroType interface{} = avroFieldType(field.Type)
+		if !field.Required {
+			avroType = []interface{}{"null", avroType}
+		}
+		fields = append(fields, map[string]interface{}{
+			"name": field.Name,
+			"type": avroType,
+		})
+	}
+
+	avroSchema, err := json.Marshal(map[string]interface{}{
+		"type":   "record",
+		"name":   "Row",
+		"fields": fields,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(avroSchema), nil
+}
+
+func avroFieldType(fieldType bigquery.FieldType) interface{} {
+	switch fieldType {
+	case bigquery.IntegerFieldType:
+		return "long"
+	case bigquery.FloatFieldType:
+		return "double"
+	case bigquery.BooleanFieldType:
+		return "boolean"
+	case bigquery.TimestampFieldType:
+		return map[string]interface{}{"type": "long", "logicalType": "timestamp-micros"}
+	case bigquery.DateFieldType:
+		return map[string]interface{}{"type": "int", "logicalType": "date"}
+	}
+
+	return "string"
+}
+
+// avroUnionName is the name goavro uses for the non-null branch of a nullable field
+func avroUnionName(fieldType bigquery.FieldType) string {
+	switch fieldType {
+	case bigquery.IntegerFieldType:
+		return "long"
+	case bigquery.FloatFieldType:
+		return "double"
+	case bigquery.BooleanFieldType:
+		return "boolean"
+	case bigquery.TimestampFieldType:
+		return "long.timestamp-micros"
+	case bigquery.DateFieldType:
+		return "int.date"
+	}
+
+	return "string"
+}
+
+func toAvroValue(field *bigquery.FieldSchema, value bigquery.Value) interface{} {
+	v := normalizeValue(value)
+	if v == nil {
+		return nil
+	}
+
+	switch field.Type {
+	case bigquery.IntegerFieldType:
+		v = toInt64(v)
+	case bigquery.FloatFieldType:
+		v = toFloat64(v)
+	case bigquery.DateFieldType:
+		if d, ok := v.(civil.Date); ok {
+			v = d.In(time.UTC)
+		}
+	case bigquery.StringFieldType:
+		if _, ok := v.(string); !ok {
+			v = fmt.Sprint(v)
+		}
+	}
+
+	if field.Required {
+		return v
+	}
+	return goavro.Union(avroUnionName(field.Type), v)
+}
+
+func toJSONValue(value bigquery.Value) interface{} {
+	v := normalizeValue(value)
+	switch t := v.(type) {
+	case time.Time:
+		return t.UTC().Format(bqTimestampLayout)
+	case civil.Date:
+		return t.String()
+	}
+
+	return v
+}
+
+// normalizeValue dereferences pointers
+func normalizeValue(value bigquery.Value) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+
+	return rv.Interface()
+}
+
+func toInt64(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	}
+
+	return v
+}
+
+func toFloat64(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	}
+
+	return v
+}
@@ -0,0 +1,53 @@
+package biqueryclient
+
+import (
+	"db-sync/data"
+	"os"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteAvro(t *testing.T) {
+	assert := assert.New(t)
+	c := &Client{}
+	schema := bigquery.Schema{
+		{Name: "_date", Type: bigquery.DateFieldType},
+		{Name: "_run_id", Type: bigquery.StringFieldType},
+		{Name: "id", Type: bigquery.IntegerFieldType, Required: true},
+		{Name: "name", Type: bigquery.StringFieldType},
+		{Name: "price", Type: bigquery.FloatFieldType},
+		{Name: "updated_at", Type: bigquery.TimestampFieldType},
+		{Name: "_created_at", Type: bigquery.TimestampFieldType},
+	}
+	name := "giakho"
+	rows := &data.Rows{Rows: []data.Row{
+		{Values: map[string]interface{}{"id": 1, "name": &name, "price": 10.5, "updated_at": time.Now()}},
+		{Values: map[string]interface{}{"id": int64(2)}},
+	}}
+
+	f, err := os.CreateTemp(t.TempDir(), "*.avro")
+	assert.Nil(err)
+	defer f.Close()
+	assert.Nil(c.writeAvro(f, schema, rows, &Run{ID: "run-1", Dest: &Destination{Timezone: time.UTC}, SyncDate: civil.DateOf(time.Now())}))
+
+	_, err = f.Seek(0, 0)
+	assert.Nil(err)
+	reader, err := goavro.NewOCFReader(f)
+	assert.Nil(err)
+	var records []map[string]interface{}
+	for reader.Scan() {
+		record, err := reader.Read()
+		assert.Nil(err)
+		records = append(records, record.(map[string]interface{}))
+	}
+	assert.Len(records, 2)
+	assert.Equal(int64(1), records[0]["id"])
+	assert.Equal(map[string]interface{}{"string": "giakho"}, records[0]["name"])
+	assert.Nil(records[1]["name"])
+	assert.Equal(map[string]interface{}{"string": "run-1"}, records[1]["_run_id"])
+}
@@ -0,0 +1,167 @@
+package biqueryclient
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MergeStatement merges the rows streamed into a presync table into the table of the main dataset
+// with one of the merge strategies. Identifiers are quoted so reserved words can be used as column names
+type MergeStatement struct {
+	// Table and Source are dataset.table names
+	Table  string
+	Source string
+	// KeyColumns identify a row of the source, the upsert strategy adds _date
+	KeyColumns []string
+	// UpdateColumns are the synced columns, keys included
+	UpdateColumns []string
+	// PartitionFilter is the condition selecting the source rows to merge, usually the partition and the run
+	PartitionFilter string
+	Strategy        MergeStrategy
+}
+
+// MergeStatement returns the statement merging the rows of the run into tableName with the strategy of the table options
+func (r *Run) MergeStatement(tableName string, keyColumns []string, updateColumns []string) MergeStatement {
+	tableName = strings.ToLower(tableName)
+	return MergeStatement{
+		Table:           fmt.Sprintf("%s.%s", r.Dest.Dataset, tableName),
+		Source:          fmt.Sprintf("%s.%s", r.Dest.PresyncDataset, tableName),
+		KeyColumns:      keyColumns,
+		UpdateColumns:   updateColumns,
+		PartitionFilter: r.PartitionFilter(),
+		Strategy:        r.Dest.TableOptions(tableName).Strategy(),
+	}
+}
+
+// PartitionFilter selects the rows of the run in its presync partition
+func (r *Run) PartitionFilter() string {
+	return fmt.Sprintf("%s = DATE %s AND %s = %s", QuoteIdentifier("_date"), QuoteString(r.SyncDate.String()), QuoteIdentifier("_run_id"), QuoteString(r.ID))
+}
+
+// SQL returns the statement of the merge strategy
+func (m MergeStatement) SQL() (string, error) {
+	if m.Table == "" || m.Source == "" || len(m.KeyColumns) == 0 || len(m.UpdateColumns) == 0 {
+		return "", fmt.Errorf("merge into %s needs a source, key columns and update columns", m.Table)
+	}
+
+	switch m.Strategy {
+	case "", MergeStrategyUpsert:
+		return m.upsertSQL(), nil
+	case MergeStrategyAppend:
+		return m.appendSQL(), nil
+	case MergeStrategySCD2:
+		return m.scd2SQL(), nil
+	}
+
+	return "", fmt.Errorf("merge strategy %s not supported yet", m.Strategy)
+}
+
+// upsertSQL keeps one version of each row per _date, the last one streamed
+func (m MergeStatement) upsertSQL() string {
+	keys := append(append([]string{}, m.KeyColumns...), "_date")
+
+	var updateItems []string
+	for _, c := range m.UpdateColumns {
+		updateItems = append(updateItems, fmt.Sprintf("%s = S.%s", QuoteIdentifier(c), QuoteIdentifier(c)))
+	}
+	updateItems = append(updateItems, fmt.Sprintf("%s = S.%s", QuoteIdentifier("_run_id"), QuoteIdentifier("_run_id")))
+	updateItems = append(updateItems, fmt.Sprintf("%s = S.%s", QuoteIdentifier("_created_at"), QuoteIdentifier("_created_at")))
+
+	insertColumns := quoteList(m.insertColumns())
+	var b strings.Builder
+	fmt.Fprintf(&b, "MERGE %s T\n", QuoteIdentifier(m.Table))
+	fmt.Fprintf(&b, "USING (%s) S\n", m.sourceSQL(keys))
+	fmt.Fprintf(&b, "ON %s\n", joinOn("T", keys, "S", keys))
+	b.WriteString("WHEN MATCHED THEN\n")
+	fmt.Fprintf(&b, "  UPDATE SET %s\n", strings.Join(updateItems, ", "))
+	b.WriteString("WHEN NOT MATCHED THEN\n")
+	fmt.Fprintf(&b, "  INSERT (%s) VALUES (%s)\n", insertColumns, insertColumns)
+	return b.String()
+}
+
+// appendSQL inserts the rows of every run
+func (m MergeStatement) appendSQL() string {
+	insertColumns := quoteList(m.insertColumns())
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s (%s)\n", QuoteIdentifier(m.Table), insertColumns)
+	fmt.Fprintf(&b, "SELECT %s FROM (%s)\n", insertColumns, m.sourceSQL(m.KeyColumns))
+	return b.String()
+}
+
+// scd2SQL compares the rows of the run with the current versions. The source holds every row of the run matching
+// on its keys, which closes the current version of the changed rows or inserts the new rows, plus the changed rows
+// once more with _merge_match false so they never match and are inserted as the new current version
+func (m MergeStatement) scd2SQL() string {
+	insertColumns := append(m.insertColumns(), "_valid_from", "_valid_to", "_is_current")
+	insertValues := append(quoteColumns(m.insertColumns()), QuoteIdentifier("_created_at"), "NULL", "TRUE")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "MERGE %s T\n", QuoteIdentifier(m.Table))
+	b.WriteString("USING (\n")
+	fmt.Fprintf(&b, "  WITH source AS (%s)\n", m.sourceSQL(m.KeyColumns))
+	fmt.Fprintf(&b, "  SELECT source.*, TRUE AS %s FROM source\n", QuoteIdentifier("_merge_match"))
+	b.WriteString("  UNION ALL\n")
+	fmt.Fprintf(&b, "  SELECT source.*, FALSE AS %s FROM source\n", QuoteIdentifier("_merge_match"))
+	fmt.Fprintf(&b, "  JOIN %s C ON %s AND C.%s\n", QuoteIdentifier(m.Table), joinOn("C", m.KeyColumns, "source", m.KeyColumns), QuoteIdentifier("_is_current"))
+	fmt.Fprintf(&b, "  WHERE %s != %s\n", rowHash("C", m.UpdateColumns), rowHash("source", m.UpdateColumns))
+	b.WriteString(") S\n")
+	fmt.Fprintf(&b, "ON %s AND T.%s AND S.%s\n", joinOn("T", m.KeyColumns, "S", m.KeyColumns), QuoteIdentifier("_is_current"), QuoteIdentifier("_merge_match"))
+	fmt.Fprintf(&b, "WHEN MATCHED AND %s != %s THEN\n", rowHash("T", m.UpdateColumns), rowHash("S", m.UpdateColumns))
+	fmt.Fprintf(&b, "  UPDATE SET %s = FALSE, %s = S.%s\n", QuoteIdentifier("_is_current"), QuoteIdentifier("_valid_to"), QuoteIdentifier("_created_at"))
+	b.WriteString("WHEN NOT MATCHED THEN\n")
+	fmt.Fprintf(&b, "  INSERT (%s) VALUES (%s)\n", quoteList(insertColumns), strings.Join(insertValues, ", "))
+	return b.String()
+}
+
+// sourceSQL deduplicates the source rows matching the partition filter by keys, keeping the last streamed version
+func (m MergeStatement) sourceSQL(keys []string) string {
+	quotedKeys := quoteList(keys)
+	return fmt.Sprintf("SELECT agg.presync.* FROM (SELECT %s, ARRAY_AGG(STRUCT(presync) ORDER BY presync.%s DESC)[SAFE_OFFSET(0)] agg FROM %s presync WHERE %s GROUP BY %s)",
+		quotedKeys, QuoteIdentifier("_created_at"), QuoteIdentifier(m.Source), m.PartitionFilter, quotedKeys)
+}
+
+func (m MergeStatement) insertColumns() []string {
+	return append(append([]string{}, m.UpdateColumns...), "_date", "_run_id", "_created_at")
+}
+
+// QuoteIdentifier quotes a column or a dataset.table name with backticks
+func QuoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "\\`") + "`"
+}
+
+// QuoteString returns the BigQuery string literal of value
+func QuoteString(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
+
+func quoteColumns(columns []string) []string {
+	var quoted []string
+	for _, c := range columns {
+		quoted = append(quoted, QuoteIdentifier(c))
+	}
+	return quoted
+}
+
+func quoteList(columns []string) string {
+	return strings.Join(quoteColumns(columns), ", ")
+}
+
+// joinOn compares the keys with IS NOT DISTINCT FROM, a null key like the _sub_id of a document without lines matches
+func joinOn(left string, leftColumns []string, right string, rightColumns []string) string {
+	var items []string
+	for i := range leftColumns {
+		items = append(items, fmt.Sprintf("%s.%s IS NOT DISTINCT FROM %s.%s", left, QuoteIdentifier(leftColumns[i]), right, QuoteIdentifier(rightColumns[i])))
+	}
+	return strings.Join(items, " AND ")
+}
+
+// rowHash fingerprints the synced columns of a row so versions are compared without a column by column comparison,
+// which would need special care for NULLs and arrays
+func rowHash(alias string, columns []string) string {
+	var fields []string
+	for _, c := range columns {
+		fields = append(fields, fmt.Sprintf("%s.%s", alias, QuoteIdentifier(c)))
+	}
+	return fmt.Sprintf("FARM_FINGERPRINT(TO_JSON_STRING(STRUCT(%s)))", strings.Join(fields, ", "))
+}
@@ -0,0 +1,48 @@
+package biqueryclient
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestMergeStatementSQL(t *testing.T) {
+	assert := assert.New(t)
+	for _, strategy := range []MergeStrategy{MergeStrategyUpsert, MergeStrategyAppend, MergeStrategySCD2} {
+		m := MergeStatement{
+			Table:           "websync.kiotviet_transfers",
+			Source:          "presync.kiotviet_transfers",
+			KeyColumns:      []string{"id", "_sub_id"},
+			UpdateColumns:   []string{"id", "_sub_id", "status", "order"},
+			PartitionFilter: "`_date` = DATE \"2022-03-03\" AND `_run_id` = \"run-1\"",
+			Strategy:        strategy,
+		}
+		query, err := m.SQL()
+		assert.Nil(err)
+
+		golden := filepath.Join("testdata", "merge_"+string(strategy)+".golden.sql")
+		if *updateGolden {
+			assert.Nil(os.WriteFile(golden, []byte(query), 0644))
+		}
+		expected, err := os.ReadFile(golden)
+		assert.Nil(err)
+		assert.Equal(string(expected), query, "strategy %s", strategy)
+	}
+
+	_, err := MergeStatement{Table: "websync.t", Source: "presync.t", KeyColumns: []string{"id"}, UpdateColumns: []string{"id"}, Strategy: "snapshot"}.SQL()
+	assert.NotNil(err)
+	_, err = MergeStatement{Table: "websync.t", Source: "presync.t", UpdateColumns: []string{"id"}}.SQL()
+	assert.NotNil(err)
+}
+
+func TestQuote(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("`order`", QuoteIdentifier("order"))
+	assert.Equal("`a\\`b`", QuoteIdentifier("a`b"))
+	assert.Equal(`"it\"s \\ ok"`, QuoteString(`it"s \ ok`))
+}
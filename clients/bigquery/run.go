@@ -0,0 +1,61 @@
+package biqueryclient
+
+import (
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/google/uuid"
+)
+
+// Run is one sync run of a pipeline into its destination. The run ID and the logical sync date are computed once
+// at the start of the run, stamped on every row as _run_id and _date and used by the merges to pick exactly
+// the rows of the run, even when the run crosses midnight
+type Run struct {
+	ID        string
+	Dest      *Destination
+	SyncDate  civil.Date
+	StartedAt time.Time
+	// DryRun runs stream into the presync dataset but their merges are only estimated, see Client.RunMerge
+	DryRun bool
+}
+
+func NewRunID() string {
+	return uuid.NewString()
+}
+
+// NewRun starts a run of the pipeline writing into dest. Pipelines run by the same process share the run ID
+func NewRun(runID string, dest *Destination) *Run {
+	now := time.Now()
+	return &Run{
+		ID:        runID,
+		Dest:      dest,
+		SyncDate:  civil.DateOf(now.In(dest.Timezone)),
+		StartedAt: now,
+	}
+}
+
+// NewBackfillRun starts a run rebuilding the partition of a past sync date. Presync partitions older than the
+// presync expiration are dropped by BigQuery as soon as they are written, so such dates can't be backfilled
+func NewBackfillRun(runID string, dest *Destination, syncDate civil.Date) (*Run, error) {
+	now := time.Now()
+	today := civil.DateOf(now.In(dest.Timezone))
+	if syncDate.After(today) {
+		return nil, fmt.Errorf("cannot backfill %s, it is in the future", syncDate)
+	}
+	if dest.PresyncExpiration > 0 && syncDate.DaysSince(today.AddDays(-int(dest.PresyncExpiration/(24*time.Hour)))) <= 0 {
+		return nil, fmt.Errorf("cannot backfill %s, it is older than the presync expiration of %s, raise BQ_PRESYNC_EXPIRATION_DAYS", syncDate, dest.PresyncExpiration)
+	}
+
+	return &Run{
+		ID:        runID,
+		Dest:      dest,
+		SyncDate:  syncDate,
+		StartedAt: now,
+	}, nil
+}
+
+// EndOfSyncDate is the last instant of the sync date in the timezone of the destination
+func (r *Run) EndOfSyncDate() time.Time {
+	return r.SyncDate.AddDays(1).In(r.Dest.Timezone).Add(-time.Nanosecond)
+}
@@ -0,0 +1,29 @@
+package biqueryclient
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBackfillRun(t *testing.T) {
+	assert := assert.New(t)
+	tz, err := time.LoadLocation("Asia/Ho_Chi_Minh")
+	assert.Nil(err)
+	dest := &Destination{Timezone: tz, PresyncExpiration: 7 * 24 * time.Hour}
+	today := civil.DateOf(time.Now().In(tz))
+
+	run, err := NewBackfillRun("run-1", dest, today.AddDays(-6))
+	assert.Nil(err)
+	assert.Equal(today.AddDays(-6), run.SyncDate)
+	end := run.EndOfSyncDate()
+	assert.Equal(today.AddDays(-6), civil.DateOf(end.In(tz)))
+	assert.Equal(today.AddDays(-5), civil.DateOf(end.Add(time.Nanosecond).In(tz)))
+
+	_, err = NewBackfillRun("run-1", dest, today.AddDays(-7))
+	assert.NotNil(err)
+	_, err = NewBackfillRun("run-1", dest, today.AddDays(1))
+	assert.NotNil(err)
+}
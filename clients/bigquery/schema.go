@@ -0,0 +1,132 @@
+package biqueryclient
+
+import (
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	log "github.com/sirupsen/logrus"
+)
+
+type SchemaChangeKind string
+
+const (
+	SchemaChangeAddColumn         SchemaChangeKind = "add_column"
+	SchemaChangeRelaxColumn       SchemaChangeKind = "relax_column"
+	SchemaChangeIncompatibleType  SchemaChangeKind = "incompatible_type"
+	SchemaChangeMissingFromSource SchemaChangeKind = "missing_from_source"
+)
+
+type SchemaChange struct {
+	Table  string
+	Column string
+	Kind   SchemaChangeKind
+	From   string
+	To     string
+}
+
+type SchemaChangeReport struct {
+	Changes []SchemaChange
+}
+
+// Applied returns true if the BigQuery schema was updated
+func (r *SchemaChangeReport) Applied() bool {
+	for _, change := range r.Changes {
+		if change.Kind == SchemaChangeAddColumn || change.Kind == SchemaChangeRelaxColumn {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *SchemaChangeReport) HasIncompatibleChanges() bool {
+	for _, change := range r.Changes {
+		if change.Kind == SchemaChangeIncompatibleType {
+			return true
+		}
+	}
+	return false
+}
+
+// Err fails the table on incompatible changes, rows of the new type would be rejected on insert or break the merge
+func (r *SchemaChangeReport) Err() error {
+	var columns []string
+	for _, change := range r.Changes {
+		if change.Kind == SchemaChangeIncompatibleType {
+			columns = append(columns, fmt.Sprintf("%s.%s %s to %s", change.Table, change.Column, change.From, change.To))
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	return fmt.Errorf("incompatible column type changes, migrate the table in Bigquery: %s", strings.Join(columns, ", "))
+}
+
+func (r *SchemaChangeReport) Log() {
+	for _, change := range r.Changes {
+		logEntry := log.WithFields(log.Fields{
+			"tableName": change.Table,
+			"column":    change.Column,
+			"kind":      change.Kind,
+			"from":      change.From,
+			"to":        change.To,
+		})
+		switch change.Kind {
+		case SchemaChangeIncompatibleType:
+			logEntry.Errorln("incompatible column type change, the table isn't synced until it is migrated in Bigquery")
+		case SchemaChangeMissingFromSource:
+			logEntry.Warnln("column exists in Bigquery but not in the source")
+		default:
+			logEntry.Infoln("schema change applied in Bigquery")
+		}
+	}
+}
+
+// diffSchema returns the existing schema with the additive changes from the source schema applied,
+// along with the list of differences. Internal fields (_date, _created_at...) are never reported as missing
+func diffSchema(existing bigquery.Schema, source bigquery.Schema) (bigquery.Schema, []SchemaChange) {
+	var changes []SchemaChange
+	sourceFields := make(map[string]*bigquery.FieldSchema)
+	for _, field := range source {
+		sourceFields[field.Name] = field
+	}
+
+	existingFields := make(map[string]bool)
+	var newSchema bigquery.Schema
+	for _, field := range existing {
+		existingFields[field.Name] = true
+		updated := *field
+		sourceField, ok := sourceFields[field.Name]
+		if !ok {
+			if !isInternalField(field.Name) {
+				changes = append(changes, SchemaChange{Column: field.Name, Kind: SchemaChangeMissingFromSource, From: string(field.Type)})
+			}
+		} else {
+			if sourceField.Type != field.Type {
+				changes = append(changes, SchemaChange{Column: field.Name, Kind: SchemaChangeIncompatibleType, From: string(field.Type), To: string(sourceField.Type)})
+			}
+			if field.Required && !sourceField.Required {
+				updated.Required = false
+				changes = append(changes, SchemaChange{Column: field.Name, Kind: SchemaChangeRelaxColumn, From: "REQUIRED", To: "NULLABLE"})
+			}
+		}
+		newSchema = append(newSchema, &updated)
+	}
+
+	for _, field := range source {
+		if existingFields[field.Name] {
+			continue
+		}
+		added := *field
+		// BigQuery only allows adding NULLABLE columns to an existing table
+		added.Required = false
+		newSchema = append(newSchema, &added)
+		changes = append(changes, SchemaChange{Column: field.Name, Kind: SchemaChangeAddColumn, To: string(field.Type)})
+	}
+
+	return newSchema, changes
+}
+
+func isInternalField(name string) bool {
+	return len(name) > 0 && name[0] == '_'
+}
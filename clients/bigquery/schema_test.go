@@ -0,0 +1,51 @@
+package biqueryclient
+
+import (
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSchema(t *testing.T) {
+	assert := assert.New(t)
+	existing := bigquery.Schema{
+		{Name: "_date", Type: bigquery.DateFieldType},
+		{Name: "id", Type: bigquery.IntegerFieldType, Required: true},
+		{Name: "name", Type: bigquery.StringFieldType, Required: true},
+		{Name: "price", Type: bigquery.IntegerFieldType},
+		{Name: "legacy", Type: bigquery.StringFieldType},
+	}
+	source := bigquery.Schema{
+		{Name: "id", Type: bigquery.IntegerFieldType, Required: true},
+		{Name: "name", Type: bigquery.StringFieldType},
+		{Name: "price", Type: bigquery.FloatFieldType},
+		{Name: "barcode", Type: bigquery.StringFieldType, Required: true},
+	}
+
+	newSchema, changes := diffSchema(existing, source)
+
+	assert.Len(newSchema, 6)
+	assert.Equal("barcode", newSchema[5].Name)
+	assert.False(newSchema[5].Required)
+	assert.False(newSchema[2].Required)
+	assert.Equal(bigquery.IntegerFieldType, newSchema[3].Type)
+	assert.Equal([]SchemaChange{
+		{Column: "name", Kind: SchemaChangeRelaxColumn, From: "REQUIRED", To: "NULLABLE"},
+		{Column: "price", Kind: SchemaChangeIncompatibleType, From: "INTEGER", To: "FLOAT"},
+		{Column: "legacy", Kind: SchemaChangeMissingFromSource, From: "STRING"},
+		{Column: "barcode", Kind: SchemaChangeAddColumn, To: "STRING"},
+	}, changes)
+}
+
+func TestSchemaChangeReportErr(t *testing.T) {
+	assert := assert.New(t)
+	report := &SchemaChangeReport{Changes: []SchemaChange{
+		{Table: "product", Column: "name", Kind: SchemaChangeRelaxColumn, From: "REQUIRED", To: "NULLABLE"},
+	}}
+	assert.Nil(report.Err())
+
+	report.Changes = append(report.Changes, SchemaChange{Table: "product", Column: "price", Kind: SchemaChangeIncompatibleType, From: "INTEGER", To: "FLOAT"})
+	assert.True(report.HasIncompatibleChanges())
+	assert.Contains(report.Err().Error(), "product.price INTEGER to FLOAT")
+}
@@ -0,0 +1,154 @@
+package biqueryclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"google.golang.org/api/iterator"
+)
+
+// SyncRunsTable is the audit table of the main dataset with one record per run and table
+const SyncRunsTable = "_sync_runs"
+
+type SyncRunStatus string
+
+const (
+	SyncRunSucceeded SyncRunStatus = "succeeded"
+	// SyncRunPartial runs merged but some rows were rejected, some batches failed or the validation found differences
+	SyncRunPartial SyncRunStatus = "partial"
+	SyncRunFailed  SyncRunStatus = "failed"
+	SyncRunDryRun  SyncRunStatus = "dry_run"
+)
+
+type SyncRunRecord struct {
+	RunID          string
+	Source         string
+	Table          string
+	SyncDate       civil.Date
+	StartedAt      time.Time
+	EndedAt        time.Time
+	RowsRead       int64
+	RowsWritten    int64
+	RowsRejected   int64
+	MergeJobID     string
+	BytesProcessed int64
+	BytesBilled    int64
+	Status         SyncRunStatus
+	Error          string
+	// Watermark is the instant the next incremental run of the table resumes from, zero for other runs
+	Watermark time.Time
+}
+
+var syncRunsSchema = bigquery.Schema{
+	{Name: "run_id", Type: bigquery.StringFieldType, Required: true},
+	{Name: "source", Type: bigquery.StringFieldType, Required: true},
+	{Name: "table_name", Type: bigquery.StringFieldType, Required: true},
+	{Name: "sync_date", Type: bigquery.DateFieldType, Required: true},
+	{Name: "started_at", Type: bigquery.TimestampFieldType, Required: true},
+	{Name: "ended_at", Type: bigquery.TimestampFieldType, Required: true},
+	{Name: "rows_read", Type: bigquery.IntegerFieldType},
+	{Name: "rows_written", Type: bigquery.IntegerFieldType},
+	{Name: "rows_rejected", Type: bigquery.IntegerFieldType},
+	{Name: "merge_job_id", Type: bigquery.StringFieldType},
+	{Name: "bytes_processed", Type: bigquery.IntegerFieldType},
+	{Name: "bytes_billed", Type: bigquery.IntegerFieldType},
+	{Name: "status", Type: bigquery.StringFieldType, Required: true},
+	{Name: "error", Type: bigquery.StringFieldType},
+	{Name: "watermark", Type: bigquery.TimestampFieldType},
+}
+
+// syncRunsTables remembers the datasets whose _sync_runs table exists
+type syncRunsTables struct {
+	lock    sync.Mutex
+	ensured map[string]bool
+}
+
+// WriteSyncRun appends the record to the _sync_runs table of the main dataset of the run, creating the table if needed
+func (c *Client) WriteSyncRun(ctx context.Context, run *Run, record SyncRunRecord) error {
+	table := c.Dataset(run.Dest.Dataset).Table(SyncRunsTable)
+	if err := c.ensureSyncRunsTable(ctx, table); err != nil {
+		return err
+	}
+
+	vss := &bigquery.ValuesSaver{
+		Schema: syncRunsSchema,
+		// the same run never audits a table twice, retried inserts are deduplicated
+		InsertID: fmt.Sprintf("%s.%s.%s", record.RunID, record.Table, record.SyncDate),
+		Row: []bigquery.Value{
+			record.RunID, record.Source, record.Table, record.SyncDate, record.StartedAt, record.EndedAt,
+			record.RowsRead, record.RowsWritten, record.RowsRejected, record.MergeJobID, record.BytesProcessed,
+			record.BytesBilled, string(record.Status), record.Error,
+			bigquery.NullTimestamp{Timestamp: record.Watermark, Valid: !record.Watermark.IsZero()},
+		},
+	}
+	return table.Inserter().Put(ctx, vss)
+}
+
+func (c *Client) ensureSyncRunsTable(ctx context.Context, table *bigquery.Table) error {
+	c.syncRuns.lock.Lock()
+	defer c.syncRuns.lock.Unlock()
+	if c.syncRuns.ensured[table.DatasetID] {
+		return nil
+	}
+
+	meta, err := table.Metadata(ctx)
+	if err == nil && len(meta.Schema) < len(syncRunsSchema) {
+		// the columns added since the table was created are nullable and appended to the schema
+		_, err = table.Update(ctx, bigquery.TableMetadataToUpdate{Schema: syncRunsSchema}, meta.ETag)
+	}
+	if isNotFound(err) {
+		err = table.Create(ctx, &bigquery.TableMetadata{
+			Description: "One record per db-sync run and table",
+			TimePartitioning: &bigquery.TimePartitioning{
+				Field: "started_at",
+			},
+			Clustering: &bigquery.Clustering{Fields: []string{"table_name"}},
+			Schema:     syncRunsSchema,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	c.syncRuns.ensured[table.DatasetID] = true
+	return nil
+}
+
+// LastWatermark returns the latest watermark recorded by a succeeded run of the table, zero when there is none
+func (c *Client) LastWatermark(ctx context.Context, dest *Destination, source string, tableName string) (time.Time, error) {
+	if _, err := c.Dataset(dest.Dataset).Table(SyncRunsTable).Metadata(ctx); err != nil {
+		if isNotFound(err) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+
+	q := c.Query(fmt.Sprintf("SELECT MAX(watermark) AS watermark FROM `%s.%s` "+
+		"WHERE source = @source AND table_name = @table_name AND status = @status", dest.Dataset, SyncRunsTable))
+	q.Parameters = []bigquery.QueryParameter{
+		{Name: "source", Value: source},
+		{Name: "table_name", Value: tableName},
+		{Name: "status", Value: string(SyncRunSucceeded)},
+	}
+	q.Location = dest.Location
+
+	it, err := q.Read(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var row struct {
+		Watermark bigquery.NullTimestamp `bigquery:"watermark"`
+	}
+	err = it.Next(&row)
+	if err == iterator.Done {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return row.Watermark.Timestamp, nil
+}
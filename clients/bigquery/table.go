@@ -0,0 +1,194 @@
+package biqueryclient
+
+import (
+	"context"
+	"db-sync/data"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+)
+
+type TableSettingChange struct {
+	Table   string
+	Setting string
+	From    string
+	To      string
+	// Applied is false for settings BigQuery can't change on an existing table
+	Applied bool
+}
+
+type EnsureTableReport struct {
+	Created  []string
+	Settings []TableSettingChange
+	Schema   SchemaChangeReport
+}
+
+func (r *EnsureTableReport) Log() {
+	for _, table := range r.Created {
+		log.WithFields(log.Fields{
+			"tableName": table,
+		}).Infoln("created table in Bigquery")
+	}
+
+	for _, change := range r.Settings {
+		logEntry := log.WithFields(log.Fields{
+			"tableName": change.Table,
+			"setting":   change.Setting,
+			"from":      change.From,
+			"to":        change.To,
+		})
+		if change.Applied {
+			logEntry.Infoln("table setting reconciled in Bigquery")
+		} else {
+			logEntry.Warnln("table setting differs in Bigquery and can't be changed in place")
+		}
+	}
+
+	r.Schema.Log()
+}
+
+// EnsureSyncTimePartitionTable creates the table in the main dataset and in the presync dataset of the destination.
+// Tables of both datasets have the _date partition field, the _run_id of the run which last wrote the row and the
+// _created_at of its streaming insert. Existing tables get their partition expiration, description
+// and schema reconciled, an incompatible column type change fails the table. It is safe to run on every sync
+func (c *Client) EnsureSyncTimePartitionTable(ctx context.Context, dest *Destination, tableName string, columns []data.Column) (*EnsureTableReport, error) {
+	metadata, preSyncMetadata, err := c.syncTableMetadata(dest, tableName, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &EnsureTableReport{}
+	if err := c.ensureTable(ctx, c.Dataset(dest.Dataset).Table(tableName), metadata, report); err != nil {
+		return report, err
+	}
+	if err := c.ensureTable(ctx, c.Dataset(dest.PresyncDataset).Table(tableName), preSyncMetadata, report); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+func (c *Client) ensureTable(ctx context.Context, table *bigquery.Table, expected *bigquery.TableMetadata, report *EnsureTableReport) error {
+	fullTableName := fmt.Sprintf("%s.%s", table.DatasetID, table.TableID)
+	current, err := table.Metadata(ctx)
+	if isNotFound(err) {
+		if err := table.Create(ctx, expected); err != nil {
+			return err
+		}
+		report.Created = append(report.Created, fullTableName)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	update, settingChanges := diffTableSettings(current, expected)
+	newSchema, schemaChanges := diffSchema(current.Schema, expected.Schema)
+	for i := range settingChanges {
+		settingChanges[i].Table = fullTableName
+	}
+	for i := range schemaChanges {
+		schemaChanges[i].Table = fullTableName
+	}
+	report.Settings = append(report.Settings, settingChanges...)
+	schemaReport := SchemaChangeReport{Changes: schemaChanges}
+	report.Schema.Changes = append(report.Schema.Changes, schemaChanges...)
+	if err := schemaReport.Err(); err != nil {
+		return err
+	}
+
+	needsUpdate := schemaReport.Applied()
+	for _, change := range settingChanges {
+		needsUpdate = needsUpdate || change.Applied
+	}
+	if !needsUpdate {
+		return nil
+	}
+
+	if schemaReport.Applied() {
+		update.Schema = newSchema
+	}
+	_, err = table.Update(ctx, update, current.ETag)
+	return err
+}
+
+// diffTableSettings compares the table level settings we manage and returns the update reconciling them
+func diffTableSettings(current *bigquery.TableMetadata, expected *bigquery.TableMetadata) (bigquery.TableMetadataToUpdate, []TableSettingChange) {
+	var update bigquery.TableMetadataToUpdate
+	var changes []TableSettingChange
+
+	if current.Description != expected.Description {
+		update.Description = expected.Description
+		changes = append(changes, TableSettingChange{Setting: "description", From: current.Description, To: expected.Description, Applied: true})
+	}
+
+	if clusteringString(current.Clustering) != clusteringString(expected.Clustering) {
+		// an empty list of fields removes the clustering
+		update.Clustering = &bigquery.Clustering{}
+		if expected.Clustering != nil {
+			update.Clustering = expected.Clustering
+		}
+		changes = append(changes, TableSettingChange{Setting: "clustering", From: clusteringString(current.Clustering), To: clusteringString(expected.Clustering), Applied: true})
+	}
+
+	if current.RequirePartitionFilter != expected.RequirePartitionFilter {
+		update.RequirePartitionFilter = expected.RequirePartitionFilter
+		changes = append(changes, TableSettingChange{Setting: "require_partition_filter", From: strconv.FormatBool(current.RequirePartitionFilter), To: strconv.FormatBool(expected.RequirePartitionFilter), Applied: true})
+	}
+
+	for name, value := range expected.Labels {
+		if current.Labels[name] != value {
+			update.SetLabel(name, value)
+			changes = append(changes, TableSettingChange{Setting: "label " + name, From: current.Labels[name], To: value, Applied: true})
+		}
+	}
+
+	currentPartitioning := partitioningString(current.TimePartitioning, current.RangePartitioning)
+	expectedPartitioning := partitioningString(expected.TimePartitioning, expected.RangePartitioning)
+	if currentPartitioning != expectedPartitioning {
+		changes = append(changes, TableSettingChange{Setting: "partitioning", From: currentPartitioning, To: expectedPartitioning})
+		return update, changes
+	}
+
+	if current.TimePartitioning != nil && current.TimePartitioning.Expiration != expected.TimePartitioning.Expiration {
+		partitioning := *current.TimePartitioning
+		partitioning.Expiration = expected.TimePartitioning.Expiration
+		update.TimePartitioning = &partitioning
+		changes = append(changes, TableSettingChange{Setting: "partition_expiration", From: current.TimePartitioning.Expiration.String(), To: expected.TimePartitioning.Expiration.String(), Applied: true})
+	}
+
+	return update, changes
+}
+
+func partitioningString(timePartitioning *bigquery.TimePartitioning, rangePartitioning *bigquery.RangePartitioning) string {
+	if rangePartitioning != nil && rangePartitioning.Range != nil {
+		r := rangePartitioning.Range
+		return fmt.Sprintf("RANGE(%s, %d, %d, %d)", rangePartitioning.Field, r.Start, r.End, r.Interval)
+	}
+	if timePartitioning == nil {
+		return "none"
+	}
+	partitioningType := timePartitioning.Type
+	if partitioningType == "" {
+		partitioningType = bigquery.DayPartitioningType
+	}
+	return fmt.Sprintf("%s(%s)", partitioningType, timePartitioning.Field)
+}
+
+func clusteringString(clustering *bigquery.Clustering) string {
+	if clustering == nil || len(clustering.Fields) == 0 {
+		return "none"
+	}
+	return strings.Join(clustering.Fields, ",")
+}
+
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
@@ -0,0 +1,149 @@
+package biqueryclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// TableOptions are the settings of the synced tables beyond their schema. They are read from the JSON file
+// BQ_TABLE_OPTIONS_FILE, keyed by BigQuery table name:
+//
+//	{"kiotviet_transfers": {"clustering": ["product_id"], "partition_granularity": "MONTH"}}
+type TableOptions struct {
+	Description string            `json:"description"`
+	Labels      map[string]string `json:"labels"`
+	Clustering  []string          `json:"clustering"`
+	// PartitionColumn of the table in the main dataset, _date by default
+	PartitionColumn string `json:"partition_column"`
+	// PartitionGranularity is DAY, MONTH or YEAR for time partitioning, RANGE for integer range partitioning
+	PartitionGranularity string          `json:"partition_granularity"`
+	PartitionRange       *PartitionRange `json:"partition_range"`
+	// RequirePartitionFilter is rejected: the merges match the rows on _date, the _latest views and the checksums read
+	// every partition, and none of them could filter a partition_column other than _date. It is only read to fail
+	// the option files still setting it, and the tables still requiring a filter get it turned off
+	RequirePartitionFilter bool `json:"require_partition_filter"`
+	// MergeStrategy is how presync rows are merged into the main dataset, upsert by default
+	MergeStrategy MergeStrategy `json:"merge_strategy"`
+}
+
+type MergeStrategy string
+
+const (
+	// MergeStrategyUpsert keeps one version of each row per _date
+	MergeStrategyUpsert MergeStrategy = "upsert"
+	// MergeStrategyAppend inserts the rows of every run
+	MergeStrategyAppend MergeStrategy = "append"
+	// MergeStrategySCD2 keeps the history of the rows as a slowly changing dimension of type 2:
+	// a changed row closes the current version (_valid_to, _is_current) and inserts a new one
+	MergeStrategySCD2 MergeStrategy = "scd2"
+)
+
+// SCD2Schema are the fields added to the tables in the main dataset merged with MergeStrategySCD2
+var SCD2Schema = bigquery.Schema{
+	{Name: "_valid_from", Type: bigquery.TimestampFieldType},
+	{Name: "_valid_to", Type: bigquery.TimestampFieldType},
+	{Name: "_is_current", Type: bigquery.BooleanFieldType},
+}
+
+type PartitionRange struct {
+	Start    int64 `json:"start"`
+	End      int64 `json:"end"`
+	Interval int64 `json:"interval"`
+}
+
+const PartitionGranularityRange = "RANGE"
+
+// LoadTableOptions reads the table options file, an empty path means no options
+func LoadTableOptions(path string) (map[string]TableOptions, error) {
+	options := make(map[string]TableOptions)
+	if path == "" {
+		return options, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &options); err != nil {
+		return nil, fmt.Errorf("invalid table options file %s: %v", path, err)
+	}
+
+	for tableName, opts := range options {
+		if err := opts.validate(); err != nil {
+			return nil, fmt.Errorf("invalid options of table %s: %v", tableName, err)
+		}
+	}
+	return options, nil
+}
+
+func (o TableOptions) validate() error {
+	switch o.MergeStrategy {
+	case "", MergeStrategyUpsert, MergeStrategyAppend, MergeStrategySCD2:
+	default:
+		return fmt.Errorf("merge strategy %s not supported yet", o.MergeStrategy)
+	}
+	if o.RequirePartitionFilter {
+		return fmt.Errorf("require_partition_filter is not supported, the merges, the _latest views and the checksums read the table without a partition filter")
+	}
+
+	switch strings.ToUpper(o.PartitionGranularity) {
+	case "", string(bigquery.DayPartitioningType), string(bigquery.MonthPartitioningType), string(bigquery.YearPartitioningType):
+		return nil
+	case PartitionGranularityRange:
+		if o.PartitionColumn == "" || o.PartitionRange == nil || o.PartitionRange.Interval <= 0 {
+			return fmt.Errorf("range partitioning needs a partition column and a range with a positive interval")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("partition granularity %s not supported yet", o.PartitionGranularity)
+}
+
+// Strategy returns the merge strategy of the table, upsert when not set
+func (o TableOptions) Strategy() MergeStrategy {
+	if o.MergeStrategy == "" {
+		return MergeStrategyUpsert
+	}
+	return o.MergeStrategy
+}
+
+func (o TableOptions) partitionColumn() string {
+	if o.PartitionColumn == "" {
+		return "_date"
+	}
+	return o.PartitionColumn
+}
+
+// partitioning returns the partitioning of the table in the main dataset
+func (o TableOptions) partitioning() (*bigquery.TimePartitioning, *bigquery.RangePartitioning) {
+	granularity := strings.ToUpper(o.PartitionGranularity)
+	if granularity == PartitionGranularityRange {
+		return nil, &bigquery.RangePartitioning{
+			Field: o.PartitionColumn,
+			Range: &bigquery.RangePartitioningRange{
+				Start:    o.PartitionRange.Start,
+				End:      o.PartitionRange.End,
+				Interval: o.PartitionRange.Interval,
+			},
+		}
+	}
+
+	if granularity == "" {
+		granularity = string(bigquery.DayPartitioningType)
+	}
+	return &bigquery.TimePartitioning{
+		Type:  bigquery.TimePartitioningType(granularity),
+		Field: o.partitionColumn(),
+	}, nil
+}
+
+func (o TableOptions) clustering() *bigquery.Clustering {
+	if len(o.Clustering) == 0 {
+		return nil
+	}
+	return &bigquery.Clustering{Fields: o.Clustering}
+}
@@ -0,0 +1,57 @@
+package biqueryclient
+
+import (
+	"db-sync/data"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncTableMetadataWithOptions(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "tables.json")
+	assert.Nil(os.WriteFile(path, []byte(`{
+		"kiotviet_transfers": {"clustering": ["product_id"], "partition_granularity": "month", "labels": {"team": "data"}},
+		"products": {"partition_column": "id", "partition_granularity": "RANGE", "partition_range": {"start": 0, "end": 1000000, "interval": 1000}}
+	}`), 0644))
+	tables, err := LoadTableOptions(path)
+	assert.Nil(err)
+
+	c := &Client{}
+	dest := &Destination{PresyncExpiration: 7 * 24 * time.Hour, Tables: tables}
+	columns := []data.Column{
+		{Name: "id", DataType: "int", From: data.ColumnFromKiotViet},
+		{Name: "product_id", DataType: "int", NullAble: true, From: data.ColumnFromKiotViet},
+	}
+
+	metadata, preSyncMetadata, err := c.syncTableMetadata(dest, "kiotviet_transfers", columns)
+	assert.Nil(err)
+	assert.Equal(bigquery.MonthPartitioningType, metadata.TimePartitioning.Type)
+	assert.Equal("_date", metadata.TimePartitioning.Field)
+	assert.Equal([]string{"product_id"}, metadata.Clustering.Fields)
+	assert.False(metadata.RequirePartitionFilter)
+	assert.Equal("data", metadata.Labels["team"])
+	assert.Equal("_date", preSyncMetadata.TimePartitioning.Field)
+	assert.Equal(7*24*time.Hour, preSyncMetadata.TimePartitioning.Expiration)
+	assert.Equal([]string{"product_id"}, preSyncMetadata.Clustering.Fields)
+
+	metadata, _, err = c.syncTableMetadata(dest, "products", columns)
+	assert.Nil(err)
+	assert.Nil(metadata.TimePartitioning)
+	assert.Equal(int64(1000), metadata.RangePartitioning.Range.Interval)
+	assert.Nil(metadata.Clustering)
+
+	assert.Nil(os.WriteFile(path, []byte(`{"products": {"partition_granularity": "RANGE"}}`), 0644))
+	_, err = LoadTableOptions(path)
+	assert.NotNil(err)
+
+	for _, strategy := range []string{"upsert", "append", "scd2"} {
+		assert.Nil(os.WriteFile(path, []byte(`{"products": {"merge_strategy": "`+strategy+`", "require_partition_filter": true}}`), 0644))
+		_, err = LoadTableOptions(path)
+		assert.NotNil(err, strategy)
+	}
+}
@@ -0,0 +1,42 @@
+package biqueryclient
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffTableSettings(t *testing.T) {
+	assert := assert.New(t)
+	current := &bigquery.TableMetadata{
+		Description: "",
+		TimePartitioning: &bigquery.TimePartitioning{
+			Type:       bigquery.DayPartitioningType,
+			Field:      "_date",
+			Expiration: 30 * 24 * time.Hour,
+		},
+	}
+	expected := &bigquery.TableMetadata{
+		Description: "presync",
+		TimePartitioning: &bigquery.TimePartitioning{
+			Field:      "_date",
+			Expiration: 7 * 24 * time.Hour,
+		},
+	}
+
+	update, changes := diffTableSettings(current, expected)
+
+	assert.Equal("presync", update.Description)
+	assert.Equal(7*24*time.Hour, update.TimePartitioning.Expiration)
+	assert.Equal("_date", update.TimePartitioning.Field)
+	assert.Len(changes, 2)
+
+	_, changes = diffTableSettings(expected, expected)
+	assert.Empty(changes)
+
+	expected.TimePartitioning.Field = "created_at"
+	_, changes = diffTableSettings(current, expected)
+	assert.Equal(TableSettingChange{Setting: "partitioning", From: "DAY(_date)", To: "DAY(created_at)"}, changes[1])
+}
@@ -0,0 +1,2 @@
+INSERT INTO `websync.kiotviet_transfers` (`id`, `_sub_id`, `status`, `order`, `_date`, `_run_id`, `_created_at`)
+SELECT `id`, `_sub_id`, `status`, `order`, `_date`, `_run_id`, `_created_at` FROM (SELECT agg.presync.* FROM (SELECT `id`, `_sub_id`, ARRAY_AGG(STRUCT(presync) ORDER BY presync.`_created_at` DESC)[SAFE_OFFSET(0)] agg FROM `presync.kiotviet_transfers` presync WHERE `_date` = DATE "2022-03-03" AND `_run_id` = "run-1" GROUP BY `id`, `_sub_id`))
@@ -0,0 +1,14 @@
+MERGE `websync.kiotviet_transfers` T
+USING (
+  WITH source AS (SELECT agg.presync.* FROM (SELECT `id`, `_sub_id`, ARRAY_AGG(STRUCT(presync) ORDER BY presync.`_created_at` DESC)[SAFE_OFFSET(0)] agg FROM `presync.kiotviet_transfers` presync WHERE `_date` = DATE "2022-03-03" AND `_run_id` = "run-1" GROUP BY `id`, `_sub_id`))
+  SELECT source.*, TRUE AS `_merge_match` FROM source
+  UNION ALL
+  SELECT source.*, FALSE AS `_merge_match` FROM source
+  JOIN `websync.kiotviet_transfers` C ON C.`id` IS NOT DISTINCT FROM source.`id` AND C.`_sub_id` IS NOT DISTINCT FROM source.`_sub_id` AND C.`_is_current`
+  WHERE FARM_FINGERPRINT(TO_JSON_STRING(STRUCT(C.`id`, C.`_sub_id`, C.`status`, C.`order`))) != FARM_FINGERPRINT(TO_JSON_STRING(STRUCT(source.`id`, source.`_sub_id`, source.`status`, source.`order`)))
+) S
+ON T.`id` IS NOT DISTINCT FROM S.`id` AND T.`_sub_id` IS NOT DISTINCT FROM S.`_sub_id` AND T.`_is_current` AND S.`_merge_match`
+WHEN MATCHED AND FARM_FINGERPRINT(TO_JSON_STRING(STRUCT(T.`id`, T.`_sub_id`, T.`status`, T.`order`))) != FARM_FINGERPRINT(TO_JSON_STRING(STRUCT(S.`id`, S.`_sub_id`, S.`status`, S.`order`))) THEN
+  UPDATE SET `_is_current` = FALSE, `_valid_to` = S.`_created_at`
+WHEN NOT MATCHED THEN
+  INSERT (`id`, `_sub_id`, `status`, `order`, `_date`, `_run_id`, `_created_at`, `_valid_from`, `_valid_to`, `_is_current`) VALUES (`id`, `_sub_id`, `status`, `order`, `_date`, `_run_id`, `_created_at`, `_created_at`, NULL, TRUE)
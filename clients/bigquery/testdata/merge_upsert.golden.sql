@@ -0,0 +1,7 @@
+MERGE `websync.kiotviet_transfers` T
+USING (SELECT agg.presync.* FROM (SELECT `id`, `_sub_id`, `_date`, ARRAY_AGG(STRUCT(presync) ORDER BY presync.`_created_at` DESC)[SAFE_OFFSET(0)] agg FROM `presync.kiotviet_transfers` presync WHERE `_date` = DATE "2022-03-03" AND `_run_id` = "run-1" GROUP BY `id`, `_sub_id`, `_date`)) S
+ON T.`id` IS NOT DISTINCT FROM S.`id` AND T.`_sub_id` IS NOT DISTINCT FROM S.`_sub_id` AND T.`_date` IS NOT DISTINCT FROM S.`_date`
+WHEN MATCHED THEN
+  UPDATE SET `id` = S.`id`, `_sub_id` = S.`_sub_id`, `status` = S.`status`, `order` = S.`order`, `_run_id` = S.`_run_id`, `_created_at` = S.`_created_at`
+WHEN NOT MATCHED THEN
+  INSERT (`id`, `_sub_id`, `status`, `order`, `_date`, `_run_id`, `_created_at`) VALUES (`id`, `_sub_id`, `status`, `order`, `_date`, `_run_id`, `_created_at`)
@@ -0,0 +1,98 @@
+package biqueryclient
+
+import (
+	"context"
+	"db-sync/data"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// LatestViewSuffix names the view of a table returning the most recent version of each row
+const LatestViewSuffix = "_latest"
+
+// EnsureLatestView creates or regenerates the <table>_latest view of the main dataset. The view lists the columns of
+// the table explicitly so it is regenerated whenever the source columns change, see latestViewQuery
+func (c *Client) EnsureLatestView(ctx context.Context, dest *Destination, tableName string, keyColumns []string, columns []data.Column) (*EnsureTableReport, error) {
+	metadata, _, err := c.syncTableMetadata(dest, tableName, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	viewName := tableName + LatestViewSuffix
+	fullViewName := fmt.Sprintf("%s.%s", dest.Dataset, viewName)
+	query := latestViewQuery(fmt.Sprintf("%s.%s", dest.Dataset, tableName), keyColumns, metadata.Schema, dest.TableOptions(tableName).Strategy())
+
+	report := &EnsureTableReport{}
+	view := c.Dataset(dest.Dataset).Table(viewName)
+	current, err := view.Metadata(ctx)
+	if isNotFound(err) {
+		err = view.Create(ctx, &bigquery.TableMetadata{
+			Description: fmt.Sprintf("Most recent version of each row of %s, generated by db-sync", tableName),
+			ViewQuery:   query,
+		})
+		if err != nil {
+			return nil, err
+		}
+		report.Created = append(report.Created, fullViewName)
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if current.ViewQuery != query {
+		if _, err := view.Update(ctx, bigquery.TableMetadataToUpdate{ViewQuery: query}, current.ETag); err != nil {
+			return nil, err
+		}
+		report.Settings = append(report.Settings, TableSettingChange{Table: fullViewName, Setting: "view_query", From: current.ViewQuery, To: query, Applied: true})
+	}
+	return report, nil
+}
+
+// latestViewQuery returns the current versions for the scd2 merge strategy, otherwise the version of the latest _date
+// of each row, the last streamed one when the append strategy merged several the same _date. Rows deleted from the
+// source keep their last synced version
+func latestViewQuery(table string, keyColumns []string, schema bigquery.Schema, strategy MergeStrategy) string {
+	return latestRowsQuery(QuoteIdentifier(table), keyColumns, schema, strategy)
+}
+
+// latestRowsQuery is latestViewQuery reading from any FROM expression. The tables keyed by _sub_id hold the lines of
+// documents and every run writes all the lines of the documents it lists, so the lines of a document are the rows of
+// its latest run: a line removed from the document, or the header row of a document without lines, is left out once
+// a later run wrote the document
+func latestRowsQuery(from string, keyColumns []string, schema bigquery.Schema, strategy MergeStrategy) string {
+	var columns []string
+	for _, field := range schema {
+		columns = append(columns, field.Name)
+	}
+
+	if strategy == MergeStrategySCD2 {
+		return fmt.Sprintf("SELECT %s FROM %s WHERE %s", quoteList(columns), from, QuoteIdentifier("_is_current"))
+	}
+
+	latest := fmt.Sprintf("ORDER BY %s DESC, %s DESC", QuoteIdentifier("_date"), QuoteIdentifier("_created_at"))
+	documentKeys := documentKeyColumns(keyColumns)
+	if len(documentKeys) < len(keyColumns) {
+		window := fmt.Sprintf("OVER (PARTITION BY %s %s)", strings.Join(quoteColumns(documentKeys), ", "), latest)
+		return fmt.Sprintf("SELECT %s FROM (SELECT *, FIRST_VALUE(%s) %s AS %s, FIRST_VALUE(%s) %s AS %s FROM %s) WHERE %s = %s AND %s IS NOT DISTINCT FROM %s",
+			quoteList(columns), QuoteIdentifier("_date"), window, QuoteIdentifier("_latest_date"), QuoteIdentifier("_run_id"), window, QuoteIdentifier("_latest_run_id"), from,
+			QuoteIdentifier("_date"), QuoteIdentifier("_latest_date"), QuoteIdentifier("_run_id"), QuoteIdentifier("_latest_run_id"))
+	}
+
+	return fmt.Sprintf("SELECT %s FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY %s %s) AS %s FROM %s) WHERE %s = 1",
+		quoteList(columns), strings.Join(quoteColumns(keyColumns), ", "), latest, QuoteIdentifier("_row_number"),
+		from, QuoteIdentifier("_row_number"))
+}
+
+// documentKeyColumns are the key columns identifying the document of a line, the keys without _sub_id
+func documentKeyColumns(keyColumns []string) []string {
+	var keys []string
+	for _, key := range keyColumns {
+		if key != "_sub_id" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,90 @@
+package biqueryclient
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/iterator"
+)
+
+func TestLatestViewQuery(t *testing.T) {
+	assert := assert.New(t)
+	schema := bigquery.Schema{
+		{Name: "_date", Type: bigquery.DateFieldType},
+		{Name: "id", Type: bigquery.IntegerFieldType},
+		{Name: "_sub_id", Type: bigquery.IntegerFieldType},
+		{Name: "order", Type: bigquery.StringFieldType},
+		{Name: "_created_at", Type: bigquery.TimestampFieldType},
+	}
+
+	query := latestViewQuery("websync.kiotviet_products", []string{"id"}, schema, MergeStrategyUpsert)
+	assert.Equal("SELECT `_date`, `id`, `_sub_id`, `order`, `_created_at` FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY `id` ORDER BY `_date` DESC, `_created_at` DESC) AS `_row_number` "+
+		"FROM `websync.kiotviet_products`) WHERE `_row_number` = 1", query)
+
+	// the append strategy keeps every run of a _date, the last streamed version wins
+	query = latestViewQuery("websync.kiotviet_products", []string{"id"}, schema, MergeStrategyAppend)
+	assert.Equal("SELECT `_date`, `id`, `_sub_id`, `order`, `_created_at` FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY `id` ORDER BY `_date` DESC, `_created_at` DESC) AS `_row_number` "+
+		"FROM `websync.kiotviet_products`) WHERE `_row_number` = 1", query)
+
+	// the lines of a document are the rows of its latest run
+	window := "OVER (PARTITION BY `id` ORDER BY `_date` DESC, `_created_at` DESC)"
+	expected := "SELECT `_date`, `id`, `_sub_id`, `order`, `_created_at` FROM (SELECT *, FIRST_VALUE(`_date`) " + window + " AS `_latest_date`, " +
+		"FIRST_VALUE(`_run_id`) " + window + " AS `_latest_run_id` FROM `websync.kiotviet_transfers`) " +
+		"WHERE `_date` = `_latest_date` AND `_run_id` IS NOT DISTINCT FROM `_latest_run_id`"
+	assert.Equal(expected, latestViewQuery("websync.kiotviet_transfers", []string{"id", "_sub_id"}, schema, MergeStrategyUpsert))
+	assert.Equal(expected, latestViewQuery("websync.kiotviet_transfers", []string{"id", "_sub_id"}, schema, MergeStrategyAppend))
+
+	query = latestViewQuery("websync.kiotviet_transfers", []string{"id", "_sub_id"}, schema, MergeStrategySCD2)
+	assert.Equal("SELECT `_date`, `id`, `_sub_id`, `order`, `_created_at` FROM `websync.kiotviet_transfers` WHERE `_is_current`", query)
+}
+
+// TestLatestRowsQueryShrinkingDocument runs the query in BigQuery over two runs of an order losing a line and of
+// an order without lines gaining one
+func TestLatestRowsQueryShrinkingDocument(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	c, err := NewClient()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	defer c.Close()
+
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.IntegerFieldType},
+		{Name: "_sub_id", Type: bigquery.IntegerFieldType},
+	}
+	from := "UNNEST([" +
+		`STRUCT(DATE "2022-07-01" AS _date, "run-1" AS _run_id, TIMESTAMP "2022-07-01 01:00:00" AS _created_at, 21 AS id, 1 AS _sub_id), ` +
+		`(DATE "2022-07-01", "run-1", TIMESTAMP "2022-07-01 01:00:00", 21, 2), ` +
+		`(DATE "2022-07-01", "run-1", TIMESTAMP "2022-07-01 01:00:00", 21, 3), ` +
+		`(DATE "2022-07-01", "run-1", TIMESTAMP "2022-07-01 01:00:00", 22, NULL), ` +
+		`(DATE "2022-07-02", "run-2", TIMESTAMP "2022-07-02 01:00:00", 21, 1), ` +
+		`(DATE "2022-07-02", "run-2", TIMESTAMP "2022-07-02 01:00:01", 21, 2), ` +
+		`(DATE "2022-07-02", "run-2", TIMESTAMP "2022-07-02 01:00:00", 22, 1)` +
+		"])"
+	q := c.Query(latestRowsQuery(from, []string{"id", "_sub_id"}, schema, MergeStrategyUpsert) + " ORDER BY `id`, `_sub_id`")
+	it, err := q.Read(ctx)
+	assert.Nil(err)
+	if err != nil {
+		return
+	}
+
+	var lines [][]bigquery.Value
+	for {
+		var row []bigquery.Value
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		assert.Nil(err)
+		if err != nil {
+			return
+		}
+		lines = append(lines, row)
+	}
+	assert.Equal([][]bigquery.Value{{int64(21), int64(1)}, {int64(21), int64(2)}, {int64(22), int64(1)}}, lines)
+}
@@ -7,9 +7,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -23,16 +25,20 @@ const (
 
 type Client struct {
 	httpClient *http.Client
+	// host of the public API
+	host string
+
+	// limiter is shared by the calls of the client, maxRetries is the number of times a failed call is made again
+	limiter    *rateLimiter
+	maxRetries int
 
 	// Web login secrets
 	userName string
 	password string
 
-	// token
-	accessToken    string
-	webAccessToken string
-	// cookies
-	webCookies []*http.Cookie
+	// tokens of the public API and of the web login, with its cookies
+	tokens    *tokenSource
+	webTokens *tokenSource
 
 	// API secrets
 	clientID     string
@@ -41,7 +47,10 @@ type Client struct {
 }
 
 type callFunc func() (*http.Request, error)
-type setAuthFunc func(ctx context.Context, req *http.Request, refreshToken bool) error
+
+// setAuthFunc authenticates req with the current token, or with a new one when stale is the current one,
+// and returns the token used
+type setAuthFunc func(ctx context.Context, req *http.Request, stale *token) (*token, error)
 
 func NewClient() (*Client, error) {
 	tr := &http.Transport{
@@ -51,14 +60,37 @@ func NewClient() (*Client, error) {
 	}
 	client := &http.Client{Transport: tr}
 
-	return &Client{
+	rateLimit := float64(DefaultRateLimit)
+	if config.KiotVietRateLimit != "" {
+		var err error
+		rateLimit, err = strconv.ParseFloat(config.KiotVietRateLimit, 64)
+		if err != nil || rateLimit < 0 {
+			return nil, fmt.Errorf("invalid KIOTVIET_RATE_LIMIT %q", config.KiotVietRateLimit)
+		}
+	}
+	maxRetries := DefaultMaxRetries
+	if config.KiotVietMaxRetries != "" {
+		var err error
+		maxRetries, err = strconv.Atoi(config.KiotVietMaxRetries)
+		if err != nil || maxRetries < 0 {
+			return nil, fmt.Errorf("invalid KIOTVIET_MAX_RETRIES %q", config.KiotVietMaxRetries)
+		}
+	}
+
+	c := &Client{
 		httpClient:   client,
+		host:         HOST,
+		limiter:      newRateLimiter(rateLimit, int(math.Ceil(rateLimit))),
+		maxRetries:   maxRetries,
 		clientID:     config.KiotVietClientID,
 		clientSecret: config.KiotVietClientSecret,
 		retailer:     config.KiotVietRetailer,
 		userName:     config.KiotVietUserName,
 		password:     config.KiotVietPassWord,
-	}, nil
+	}
+	c.tokens = newTokenSource("public", config.KiotVietTokenCacheDir, c.retailer, c.fetchToken)
+	c.webTokens = newTokenSource("web", config.KiotVietTokenCacheDir, c.retailer, c.fetchWebToken)
+	return c, nil
 }
 
 func (c *Client) getWebAccessToken(ctx context.Context) (*WebAccessToken, error) {
@@ -80,7 +112,7 @@ func (c *Client) getWebAccessToken(ctx context.Context) (*WebAccessToken, error)
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonValue))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonValue))
 	if err != nil {
 		return nil, err
 	}
@@ -119,7 +151,13 @@ func (c *Client) getAccessToken(ctx context.Context) (*AccessToken, error) {
 		"client_secret": {c.clientSecret},
 	}
 
-	resp, err := http.PostForm(AuthEndpoint, form)
+	req, err := http.NewRequestWithContext(ctx, "POST", AuthEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -142,107 +180,334 @@ func (c *Client) getAccessToken(ctx context.Context) (*AccessToken, error) {
 	return &token, nil
 }
 
-func (c *Client) setAuthHeaders(ctx context.Context, req *http.Request, refreshToken bool) error {
-	if refreshToken {
-		accessToken, err := c.getAccessToken(ctx)
-		if err != nil {
-			return err
-		}
-		c.accessToken = accessToken.AccessToken
+// fetchToken gets a token of the public API, expiring after its expires_in
+func (c *Client) fetchToken(ctx context.Context) (*token, error) {
+	accessToken, err := c.getAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t := &token{Value: accessToken.AccessToken}
+	if accessToken.ExpiresIn > 0 {
+		t.ExpiresAt = time.Now().Add(time.Duration(accessToken.ExpiresIn) * time.Second)
+	}
+	return t, nil
+}
+
+// fetchWebToken logs in the web API, its token has no known expiry and is only refreshed when refused
+func (c *Client) fetchWebToken(ctx context.Context) (*token, error) {
+	accessToken, err := c.getWebAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &token{Value: accessToken.Token, Cookies: accessToken.Cookies}, nil
+}
+
+func (c *Client) setAuthHeaders(ctx context.Context, req *http.Request, stale *token) (*token, error) {
+	t, err := c.tokens.Token(ctx, stale)
+	if err != nil {
+		return nil, err
 	}
 
 	req.Header.Add("Retailer", c.retailer)
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.accessToken))
-	return nil
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", t.Value))
+	return t, nil
 }
 
-func (c *Client) setWebAuthHeaders(ctx context.Context, req *http.Request, refreshToken bool) error {
-	if refreshToken || c.webAccessToken == "" {
-		accessToken, err := c.getWebAccessToken(ctx)
-		if err != nil {
-			return err
-		}
-		c.webAccessToken = accessToken.Token
-		c.webCookies = accessToken.Cookies
+func (c *Client) setWebAuthHeaders(ctx context.Context, req *http.Request, stale *token) (*token, error) {
+	t, err := c.webTokens.Token(ctx, stale)
+	if err != nil {
+		return nil, err
 	}
 
 	req.Header.Add("retailer", c.retailer)
-	req.Header.Add("authorization", fmt.Sprintf("Bearer %s", c.webAccessToken))
-	for _, cookie := range c.webCookies {
+	req.Header.Add("authorization", fmt.Sprintf("Bearer %s", t.Value))
+	for _, cookie := range t.Cookies {
 		req.AddCookie(cookie)
 	}
 
-	return nil
+	return t, nil
+}
+
+// try makes a call once the rate limiter allows it. A 401 refreshes the access token before making the call again,
+// a 429 makes it again after a backoff up to maxRetries times, so do a 5xx or a network error when the call is
+// idempotent: a call which isn't may have been processed. The response of the last call is returned whatever its status
+func (c *Client) try(ctx context.Context, fn callFunc, authFunc setAuthFunc, idempotent bool) (*http.Response, error) {
+	refreshed := false
+	var used, stale *token
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		req, err := fn()
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		if used, err = authFunc(ctx, req, stale); err != nil {
+			return nil, err
+		}
+
+		resp, err := c.httpClient.Do(req)
+		switch {
+		case err == nil && resp.StatusCode == http.StatusUnauthorized && !refreshed:
+			// the token was refused, it is refreshed once without counting as a retry
+			refreshed, stale = true, used
+			attempt--
+		case retryable(resp, err, idempotent) && attempt < c.maxRetries && ctx.Err() == nil:
+			delay := retryDelay(attempt, resp)
+			logEntry := log.WithFields(log.Fields{
+				"url":     req.URL.Path,
+				"attempt": attempt + 1,
+				"delay":   delay,
+			})
+			if err != nil {
+				logEntry.WithField("error", err).Warnln("error calling KiotViet, retrying")
+			} else {
+				logEntry.WithField("statusCode", resp.StatusCode).Warnln("error calling KiotViet, retrying")
+			}
+			if err := sleep(ctx, delay); err != nil {
+				if resp != nil {
+					resp.Body.Close()
+				}
+				return nil, err
+			}
+		default:
+			return resp, err
+		}
+
+		if resp != nil {
+			if err := resp.Body.Close(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// decodeResponse decodes the JSON of a response with a success status into v when v isn't nil,
+// the other responses are decoded into an *APIError
+func decodeResponse(path string, resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return newAPIError(path, resp.StatusCode, body)
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(body, v)
 }
 
-func (c *Client) try(ctx context.Context, fn callFunc, authFunc setAuthFunc) (*http.Response, error) {
-	req, err := fn()
+// getPublic calls the public API and decodes the JSON response into v
+func (c *Client) getPublic(ctx context.Context, path string, query url.Values, v interface{}) error {
+	var fn = func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", c.host+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.URL.RawQuery = query.Encode()
+		return req, nil
+	}
+
+	resp, err := c.try(ctx, fn, c.setAuthHeaders, true)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(path, resp, v)
+}
+
+// postPublic posts the JSON of payload to the public API and decodes the JSON response into v when v isn't nil
+func (c *Client) postPublic(ctx context.Context, path string, payload interface{}, v interface{}) error {
+	jsonValue, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	var fn = func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", c.host+path, bytes.NewBuffer(jsonValue))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Content-Type", "application/json")
+		return req, nil
+	}
+
+	// a POST isn't idempotent, only the calls which were refused before being processed are made again
+	resp, err := c.try(ctx, fn, c.setAuthHeaders, false)
 	if err != nil {
+		return err
+	}
+	return decodeResponse(path, resp, v)
+}
+
+// pageQuery is the query of a page of a list endpoint ordered by id
+func pageQuery(limit int, offset int, orderDirection string) url.Values {
+	return url.Values{
+		"pageSize":       {strconv.Itoa(limit)},
+		"currentItem":    {strconv.Itoa(offset)},
+		"orderBy":        {"id"},
+		"orderDirection": {orderDirection},
+	}
+}
+
+// modifiedPageQuery is the query of a page of the documents modified since lastModifiedFrom, all when it is zero.
+// lastModifiedFrom is a local time of the retailer
+func modifiedPageQuery(lastModifiedFrom time.Time, limit int, offset int, orderDirection string) url.Values {
+	q := pageQuery(limit, offset, orderDirection)
+	if !lastModifiedFrom.IsZero() {
+		q.Add("lastModifiedFrom", lastModifiedFrom.Format(KiotTimeLayout))
+	}
+	return q
+}
+
+// ListTransfers lists the transfers modified since lastModifiedFrom by descending id
+func (c *Client) ListTransfers(ctx context.Context, lastModifiedFrom time.Time, limit int, offset int) (*TransferPage, error) {
+	var page TransferPage
+	if err := c.getPublic(ctx, "transfers", modifiedPageQuery(lastModifiedFrom, limit, offset, "DESC"), &page); err != nil {
 		return nil, err
 	}
+	return &page, nil
+}
 
-	if err = authFunc(ctx, req, false); err != nil {
+// ListProducts lists the product catalog by ascending id. includeInventory adds the on-hand inventory of every branch
+// and includePricebook the prices of the price books
+func (c *Client) ListProducts(ctx context.Context, limit int, offset int, includeInventory bool, includePricebook bool) (*ProductPage, error) {
+	var page ProductPage
+	q := pageQuery(limit, offset, "ASC")
+	q.Add("includeInventory", strconv.FormatBool(includeInventory))
+	q.Add("includePricebook", strconv.FormatBool(includePricebook))
+	if err := c.getPublic(ctx, "products", q, &page); err != nil {
 		return nil, err
 	}
+	return &page, nil
+}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
+// ListInvoices lists the invoices matching the filter by ascending id, with their details and payments
+func (c *Client) ListInvoices(ctx context.Context, filter InvoiceFilter, limit int, offset int) (*InvoicePage, error) {
+	var page InvoicePage
+	q := modifiedPageQuery(filter.LastModifiedFrom, limit, offset, "ASC")
+	q.Add("includePayment", "true")
+	if !filter.FromPurchaseDate.IsZero() {
+		q.Add("fromPurchaseDate", filter.FromPurchaseDate.Format(KiotTimeLayout))
+	}
+	if !filter.ToPurchaseDate.IsZero() {
+		q.Add("toPurchaseDate", filter.ToPurchaseDate.Format(KiotTimeLayout))
+	}
+	for _, branchID := range filter.BranchIDs {
+		q.Add("branchIds", strconv.FormatInt(branchID, 10))
+	}
+	if err := c.getPublic(ctx, "invoices", q, &page); err != nil {
 		return nil, err
 	}
-	if resp.StatusCode != 401 {
-		return resp, err
+	return &page, nil
+}
+
+// ListOrders lists the customer orders modified since lastModifiedFrom by descending id, like the transfers
+func (c *Client) ListOrders(ctx context.Context, lastModifiedFrom time.Time, limit int, offset int) (*OrderPage, error) {
+	var page OrderPage
+	if err := c.getPublic(ctx, "orders", modifiedPageQuery(lastModifiedFrom, limit, offset, "DESC"), &page); err != nil {
+		return nil, err
 	}
+	return &page, nil
+}
 
-	// If we get a response with 401(Unauthorized) status, we refresh the access token then make the call again
-	if err = resp.Body.Close(); err != nil {
+// GetOrder returns the order with all its lines
+func (c *Client) GetOrder(ctx context.Context, orderID int64) (*Order, error) {
+	var order Order
+	if err := c.getPublic(ctx, fmt.Sprintf("orders/%d", orderID), url.Values{}, &order); err != nil {
 		return nil, err
 	}
+	return &order, nil
+}
 
-	req, err = fn()
-	if err != nil {
+// ListReturns lists the sales returns modified since lastModifiedFrom by descending id
+func (c *Client) ListReturns(ctx context.Context, lastModifiedFrom time.Time, limit int, offset int) (*ReturnPage, error) {
+	var page ReturnPage
+	if err := c.getPublic(ctx, "returns", modifiedPageQuery(lastModifiedFrom, limit, offset, "DESC"), &page); err != nil {
 		return nil, err
 	}
+	return &page, nil
+}
 
-	if err = authFunc(ctx, req, true); err != nil {
+// GetReturn returns the sales return with all its lines
+func (c *Client) GetReturn(ctx context.Context, returnID int64) (*Return, error) {
+	var r Return
+	if err := c.getPublic(ctx, fmt.Sprintf("returns/%d", returnID), url.Values{}, &r); err != nil {
 		return nil, err
 	}
+	return &r, nil
+}
 
-	return c.httpClient.Do(req)
+// ListPurchaseOrders lists the purchase orders modified since lastModifiedFrom by descending id
+func (c *Client) ListPurchaseOrders(ctx context.Context, lastModifiedFrom time.Time, limit int, offset int) (*PurchaseOrderPage, error) {
+	var page PurchaseOrderPage
+	if err := c.getPublic(ctx, "purchaseorders", modifiedPageQuery(lastModifiedFrom, limit, offset, "DESC"), &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
 }
 
-func (c *Client) ListTransfers(ctx context.Context, limit int, offset int) (*TransferPage, error) {
+// GetPurchaseOrder returns the purchase order with all its lines
+func (c *Client) GetPurchaseOrder(ctx context.Context, purchaseOrderID int64) (*PurchaseOrder, error) {
+	var purchaseOrder PurchaseOrder
+	if err := c.getPublic(ctx, fmt.Sprintf("purchaseorders/%d", purchaseOrderID), url.Values{}, &purchaseOrder); err != nil {
+		return nil, err
+	}
+	return &purchaseOrder, nil
+}
 
-	var page TransferPage
-	var fn = func() (*http.Request, error) {
-		req, err := http.NewRequest("GET", HOST+"transfers", nil)
-		q := req.URL.Query()
-		q.Add("pageSize", strconv.Itoa(limit))
-		q.Add("currentItem", strconv.Itoa(offset))
-		q.Add("orderBy", "id")
-		q.Add("orderDirection", "DESC")
-		req.URL.RawQuery = q.Encode()
-		return req, err
+func (c *Client) ListBranches(ctx context.Context, limit int, offset int) (*BranchPage, error) {
+	var page BranchPage
+	if err := c.getPublic(ctx, "branches", pageQuery(limit, offset, "ASC"), &page); err != nil {
+		return nil, err
 	}
+	return &page, nil
+}
 
-	resp, err := c.try(ctx, fn, c.setAuthHeaders)
-	if err != nil {
+func (c *Client) ListUsers(ctx context.Context, limit int, offset int) (*UserPage, error) {
+	var page UserPage
+	if err := c.getPublic(ctx, "users", pageQuery(limit, offset, "ASC"), &page); err != nil {
 		return nil, err
 	}
+	return &page, nil
+}
 
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
+// ListCategories lists the categories flattened, a sub category refers to its parent by ParentID
+func (c *Client) ListCategories(ctx context.Context, limit int, offset int) (*CategoryPage, error) {
+	var page CategoryPage
+	q := pageQuery(limit, offset, "ASC")
+	// categories are identified by categoryId
+	q.Set("orderBy", "categoryId")
+	q.Add("hierachicalData", "false")
+	if err := c.getPublic(ctx, "categories", q, &page); err != nil {
 		return nil, err
 	}
+	return &page, nil
+}
 
-	err = json.Unmarshal(body, &page)
-	if err != nil {
+func (c *Client) ListSuppliers(ctx context.Context, limit int, offset int) (*SupplierPage, error) {
+	var page SupplierPage
+	if err := c.getPublic(ctx, "suppliers", pageQuery(limit, offset, "ASC"), &page); err != nil {
 		return nil, err
 	}
+	return &page, nil
+}
 
+func (c *Client) ListCustomers(ctx context.Context, limit int, offset int) (*CustomerPage, error) {
+	var page CustomerPage
+	if err := c.getPublic(ctx, "customers", pageQuery(limit, offset, "ASC"), &page); err != nil {
+		return nil, err
+	}
 	return &page, nil
 }
 
+// RegisterWebhook subscribes the URL of the registration to its webhook type
+func (c *Client) RegisterWebhook(ctx context.Context, registration WebhookRegistration) error {
+	return c.postPublic(ctx, "webhooks", map[string]interface{}{"Webhook": registration}, nil)
+}
+
 func (c *Client) GetTransferDetailWeb(ctx context.Context, transferID int64) (*WebTransferDetailResp, error) {
 	var detailResp WebTransferDetailResp
 	var fn = func() (*http.Request, error) {
@@ -254,19 +519,11 @@ func (c *Client) GetTransferDetailWeb(ctx context.Context, transferID int64) (*W
 		return req, err
 	}
 
-	resp, err := c.try(ctx, fn, c.setWebAuthHeaders)
+	resp, err := c.try(ctx, fn, c.setWebAuthHeaders, true)
 	if err != nil {
 		return nil, err
 	}
-
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	err = json.Unmarshal(body, &detailResp)
-	if err != nil {
+	if err := decodeResponse(fmt.Sprintf("transferDetails/%d", transferID), resp, &detailResp); err != nil {
 		return nil, err
 	}
 
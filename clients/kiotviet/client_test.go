@@ -2,8 +2,14 @@ package kiotviet
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -26,7 +32,7 @@ func TestListTransfers(t *testing.T) {
 	c, err := NewClient()
 	assert.Nil(err)
 
-	page, err := c.ListTransfers(ctx, 100, 5)
+	page, err := c.ListTransfers(ctx, time.Time{}, 100, 5)
 
 	assert.Nil(err)
 	assert.True(page.Total > 0)
@@ -55,3 +61,220 @@ func TestGetTransferDetail(t *testing.T) {
 	assert.Nil(err)
 	assert.NotNil(transfer)
 }
+
+func newTestClient(handler http.HandlerFunc) (*Client, *httptest.Server) {
+	server := httptest.NewServer(handler)
+	return &Client{
+		httpClient: server.Client(),
+		host:       server.URL + "/",
+		limiter:    newRateLimiter(0, 0),
+		maxRetries: 2,
+		tokens:     &tokenSource{token: &token{Value: "token"}, loaded: true},
+	}, server
+}
+
+func TestGetPublicRetries(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	c, server := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal("Bearer token", r.Header.Get("Authorization"))
+		switch calls {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{"total": 1, "data": [{"id": 7}]}`))
+		}
+	})
+	defer server.Close()
+
+	var page TransferPage
+	err := c.getPublic(context.Background(), "transfers", nil, &page)
+	assert.Nil(err)
+	assert.Equal(3, calls)
+	assert.Equal(int64(1), page.Total)
+}
+
+func TestGetPublicAPIError(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	c, server := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"responseStatus": {"errorCode": "ServiceUnavailable", "message": "Hệ thống đang bận"}}`))
+	})
+	defer server.Close()
+
+	var page TransferPage
+	err := c.getPublic(context.Background(), "transfers", nil, &page)
+	var apiErr *APIError
+	assert.True(errors.As(err, &apiErr))
+	assert.Equal(3, calls)
+	assert.Equal(http.StatusServiceUnavailable, apiErr.StatusCode)
+	assert.Equal("ServiceUnavailable", apiErr.ErrorCode)
+	assert.True(apiErr.Temporary())
+
+	// a client error isn't retried and its body isn't decoded as a page
+	calls = 0
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`bad request`))
+	})
+	err = c.getPublic(context.Background(), "transfers", nil, &page)
+	assert.True(errors.As(err, &apiErr))
+	assert.Equal(1, calls)
+	assert.Equal("bad request", apiErr.Body)
+	assert.False(apiErr.Temporary())
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+	d, ok := parseRetryAfter("3")
+	assert.True(ok)
+	assert.Equal(3*time.Second, d)
+	d, ok = parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(ok)
+	assert.True(d > 50*time.Second && d <= time.Minute)
+	_, ok = parseRetryAfter("soon")
+	assert.False(ok)
+
+	for attempt := 0; attempt < 10; attempt++ {
+		d := retryDelay(attempt, nil)
+		assert.True(d >= retryBaseDelay/2 && d <= retryMaxDelay)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	assert := assert.New(t)
+	l := newRateLimiter(20, 1)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.Nil(l.Wait(context.Background()))
+	}
+	assert.True(time.Since(start) >= 90*time.Millisecond)
+
+	l = newRateLimiter(0.001, 1)
+	assert.Nil(l.Wait(context.Background()))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NotNil(l.Wait(ctx))
+}
+
+func TestTokenSourceSingleRefresh(t *testing.T) {
+	assert := assert.New(t)
+	var fetches int32
+	s := newTokenSource("public", "", "retailer", func(ctx context.Context) (*token, error) {
+		n := atomic.AddInt32(&fetches, 1)
+		time.Sleep(10 * time.Millisecond)
+		return &token{Value: fmt.Sprintf("token-%d", n)}, nil
+	})
+	first, err := s.Token(context.Background(), nil)
+	assert.Nil(err)
+
+	// every goroutine refused with the first token asks for a new one, a single login happens
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			refreshed, err := s.Token(context.Background(), first)
+			assert.Nil(err)
+			assert.Equal("token-2", refreshed.Value)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(int32(2), fetches)
+}
+
+func TestTokenSourceExpiryAndCache(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	fetches := 0
+	fetch := func(ctx context.Context) (*token, error) {
+		fetches++
+		return &token{Value: fmt.Sprintf("token-%d", fetches), ExpiresAt: time.Now().Add(time.Hour)}, nil
+	}
+
+	s := newTokenSource("public", dir, "retailer", fetch)
+	tok, err := s.Token(context.Background(), nil)
+	assert.Nil(err)
+	assert.Equal("token-1", tok.Value)
+
+	// the next run reuses the cached token
+	s = newTokenSource("public", dir, "retailer", fetch)
+	tok, err = s.Token(context.Background(), nil)
+	assert.Nil(err)
+	assert.Equal("token-1", tok.Value)
+	assert.Equal(1, fetches)
+
+	// a token about to expire is refreshed before being used
+	s.token.ExpiresAt = time.Now().Add(tokenExpiryMargin / 2)
+	tok, err = s.Token(context.Background(), nil)
+	assert.Nil(err)
+	assert.Equal("token-2", tok.Value)
+}
+
+func TestPostPublicNotRetried(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	c, server := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal("POST", r.Method)
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	defer server.Close()
+
+	// the webhook may have been registered before the 5xx, it isn't registered again
+	err := c.RegisterWebhook(context.Background(), WebhookRegistration{Type: "product.update", URL: "https://example.com"})
+	var apiErr *APIError
+	assert.True(errors.As(err, &apiErr))
+	assert.Equal(http.StatusBadGateway, apiErr.StatusCode)
+	assert.Equal(1, calls)
+
+	// a rate limited call wasn't processed, it is made again
+	calls = 0
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	assert.Nil(c.RegisterWebhook(context.Background(), WebhookRegistration{Type: "product.update", URL: "https://example.com"}))
+	assert.Equal(2, calls)
+}
+
+func TestTryRefreshesRefusedToken(t *testing.T) {
+	assert := assert.New(t)
+	c, server := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"total": 1}`))
+	})
+	defer server.Close()
+	c.tokens.fetch = func(ctx context.Context) (*token, error) {
+		return &token{Value: "fresh"}, nil
+	}
+
+	var page TransferPage
+	assert.Nil(c.getPublic(context.Background(), "transfers", nil, &page))
+	assert.Equal(int64(1), page.Total)
+}
+
+func TestAccessTokenExpiresIn(t *testing.T) {
+	assert := assert.New(t)
+	var accessToken AccessToken
+	assert.Nil(json.Unmarshal([]byte(`{"access_token": "token", "expires_in": 86400, "token_type": "Bearer"}`), &accessToken))
+	assert.Equal(int64(86400), accessToken.ExpiresIn)
+}
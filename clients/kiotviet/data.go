@@ -18,8 +18,9 @@ type KiotTime struct {
 
 type AccessToken struct {
 	AccessToken string `json:"access_token"`
-	ExpiredIn   int64  `json:"expired_id"`
-	TokenType   string `json:"token_type"`
+	// ExpiresIn is the lifetime of the token in seconds
+	ExpiresIn int64  `json:"expires_in"`
+	TokenType string `json:"token_type"`
 }
 
 type TransferPage struct {
@@ -40,6 +41,7 @@ type TransferBasicInfo struct {
 	ReceivedDate   *KiotTime        `json:"receivedDate"`
 	RetailerID     int64            `json:"retailerId"`
 	Description    string           `json:"description"` // Ghi chu chuyen
+	CreatedByID    *int64           `json:"createdById"`
 	TransferDetail []TransferDetail `json:"transferDetails"`
 }
 
@@ -54,6 +56,384 @@ type TransferDetail struct {
 	Price            float64 `json:"price"`
 }
 
+type ProductPage struct {
+	Total    int64     `json:"total"`
+	PageSize int64     `json:"pageSize"`
+	Products []Product `json:"data"`
+}
+
+type Product struct {
+	ID              int64     `json:"id"`
+	Code            string    `json:"code"`
+	BarCode         string    `json:"barCode"`
+	Name            string    `json:"name"`
+	FullName        string    `json:"fullName"`
+	CategoryID      int64     `json:"categoryId"`
+	CategoryName    string    `json:"categoryName"`
+	AllowsSale      bool      `json:"allowsSale"`
+	Type            int       `json:"type"`
+	HasVariants     bool      `json:"hasVariants"`
+	BasePrice       float64   `json:"basePrice"`
+	Weight          float64   `json:"weight"`
+	Unit            string    `json:"unit"`
+	MasterProductID *int64    `json:"masterProductId"`
+	MasterUnitID    *int64    `json:"masterUnitId"`
+	ConversionValue float64   `json:"conversionValue"`
+	Description     string    `json:"description"`
+	IsActive        bool      `json:"isActive"`
+	RetailerID      int64     `json:"retailerId"`
+	CreatedDate     *KiotTime `json:"createdDate"`
+	ModifiedDate    *KiotTime `json:"modifiedDate"`
+	// Inventories are only returned with includeInventory, one per branch
+	Inventories []ProductInventory `json:"inventories"`
+	// PriceBooks are only returned with includePricebook
+	PriceBooks []ProductPriceBook `json:"priceBooks"`
+}
+
+type ProductInventory struct {
+	ProductID   int64   `json:"productId"`
+	ProductCode string  `json:"productCode"`
+	ProductName string  `json:"productName"`
+	BranchID    int64   `json:"branchId"`
+	BranchName  string  `json:"branchName"`
+	Cost        float64 `json:"cost"`
+	OnHand      float64 `json:"onHand"`
+	Reserved    float64 `json:"reserved"`
+	MinQuantity float64 `json:"minQuantity"`
+	MaxQuantity float64 `json:"maxQuantity"`
+	OnOrder     float64 `json:"onOrder"`
+}
+
+type ProductPriceBook struct {
+	PriceBookID   int64     `json:"priceBookId"`
+	PriceBookName string    `json:"priceBookName"`
+	ProductID     int64     `json:"productId"`
+	IsActive      bool      `json:"isActive"`
+	StartDate     *KiotTime `json:"startDate"`
+	EndDate       *KiotTime `json:"endDate"`
+	Price         float64   `json:"price"`
+}
+
+type InvoicePage struct {
+	Total    int64     `json:"total"`
+	PageSize int64     `json:"pageSize"`
+	Invoices []Invoice `json:"data"`
+}
+
+type Invoice struct {
+	ID           int64     `json:"id"`
+	UUID         string    `json:"uuid"`
+	Code         string    `json:"code"`
+	PurchaseDate *KiotTime `json:"purchaseDate"`
+	BranchID     int64     `json:"branchId"`
+	BranchName   string    `json:"branchName"`
+	SoldByID     int64     `json:"soldById"`
+	SoldByName   string    `json:"soldByName"`
+	CustomerID   *int64    `json:"customerId"`
+	CustomerCode string    `json:"customerCode"`
+	CustomerName string    `json:"customerName"`
+	OrderCode    string    `json:"orderCode"`
+	Total        float64   `json:"total"`
+	TotalPayment float64   `json:"totalPayment"`
+	Discount     float64   `json:"discount"`
+	Status       int       `json:"status"`
+	StatusValue  string    `json:"statusValue"`
+	Description  string    `json:"description"`
+	UsingCod     bool      `json:"usingCod"`
+	RetailerID   int64     `json:"retailerId"`
+	CreatedDate  *KiotTime `json:"createdDate"`
+	ModifiedDate *KiotTime `json:"modifiedDate"`
+	// InvoiceDetails are the lines of the invoice, in the order of the invoice
+	InvoiceDetails []InvoiceDetail `json:"invoiceDetails"`
+	// Payments are only returned with includePayment
+	Payments []InvoicePayment `json:"payments"`
+}
+
+type InvoiceDetail struct {
+	ProductID     int64   `json:"productId"`
+	ProductCode   string  `json:"productCode"`
+	ProductName   string  `json:"productName"`
+	Quantity      float64 `json:"quantity"`
+	Price         float64 `json:"price"`
+	Discount      float64 `json:"discount"`
+	DiscountRatio float64 `json:"discountRatio"`
+	SubTotal      float64 `json:"subTotal"`
+	Note          string  `json:"note"`
+	SerialNumbers string  `json:"serialNumbers"`
+}
+
+type InvoicePayment struct {
+	ID          int64     `json:"id"`
+	Code        string    `json:"code"`
+	Amount      float64   `json:"amount"`
+	Method      string    `json:"method"`
+	Status      int       `json:"status"`
+	StatusValue string    `json:"statusValue"`
+	TransDate   *KiotTime `json:"transDate"`
+	BankAccount string    `json:"bankAccount"`
+	AccountID   *int64    `json:"accountId"`
+}
+
+// InvoiceFilter narrows the invoices listed, zero values don't filter.
+// Dates are local times of the retailer, like the dates returned by KiotViet
+type InvoiceFilter struct {
+	FromPurchaseDate time.Time
+	ToPurchaseDate   time.Time
+	LastModifiedFrom time.Time
+	BranchIDs        []int64
+}
+
+type OrderPage struct {
+	Total    int64   `json:"total"`
+	PageSize int64   `json:"pageSize"`
+	Orders   []Order `json:"data"`
+}
+
+// Order is a customer order, its lines are only complete when returned by GetOrder
+type Order struct {
+	ID           int64         `json:"id"`
+	Code         string        `json:"code"`
+	PurchaseDate *KiotTime     `json:"purchaseDate"`
+	BranchID     int64         `json:"branchId"`
+	BranchName   string        `json:"branchName"`
+	SoldByID     int64         `json:"soldById"`
+	SoldByName   string        `json:"soldByName"`
+	CustomerID   *int64        `json:"customerId"`
+	CustomerCode string        `json:"customerCode"`
+	CustomerName string        `json:"customerName"`
+	Total        float64       `json:"total"`
+	TotalPayment float64       `json:"totalPayment"`
+	Discount     float64       `json:"discount"`
+	Status       int           `json:"status"`
+	StatusValue  string        `json:"statusValue"`
+	Description  string        `json:"description"`
+	RetailerID   int64         `json:"retailerId"`
+	CreatedDate  *KiotTime     `json:"createdDate"`
+	ModifiedDate *KiotTime     `json:"modifiedDate"`
+	OrderDetails []OrderDetail `json:"orderDetails"`
+}
+
+type OrderDetail struct {
+	ProductID     int64   `json:"productId"`
+	ProductCode   string  `json:"productCode"`
+	ProductName   string  `json:"productName"`
+	Quantity      float64 `json:"quantity"`
+	Price         float64 `json:"price"`
+	Discount      float64 `json:"discount"`
+	DiscountRatio float64 `json:"discountRatio"`
+	Note          string  `json:"note"`
+}
+
+type ReturnPage struct {
+	Total    int64    `json:"total"`
+	PageSize int64    `json:"pageSize"`
+	Returns  []Return `json:"data"`
+}
+
+// Return is a sales return of an invoice, its lines are only complete when returned by GetReturn
+type Return struct {
+	ID             int64          `json:"id"`
+	Code           string         `json:"code"`
+	InvoiceID      *int64         `json:"invoiceId"`
+	ReturnDate     *KiotTime      `json:"returnDate"`
+	BranchID       int64          `json:"branchId"`
+	BranchName     string         `json:"branchName"`
+	ReceivedByID   int64          `json:"receivedById"`
+	SoldByName     string         `json:"soldByName"`
+	CustomerID     *int64         `json:"customerId"`
+	CustomerCode   string         `json:"customerCode"`
+	CustomerName   string         `json:"customerName"`
+	ReturnTotal    float64        `json:"returnTotal"`
+	ReturnDiscount float64        `json:"returnDiscount"`
+	ReturnFee      float64        `json:"returnFee"`
+	TotalPayment   float64        `json:"totalPayment"`
+	Status         int            `json:"status"`
+	StatusValue    string         `json:"statusValue"`
+	RetailerID     int64          `json:"retailerId"`
+	CreatedDate    *KiotTime      `json:"createdDate"`
+	ModifiedDate   *KiotTime      `json:"modifiedDate"`
+	ReturnDetails  []ReturnDetail `json:"returnDetails"`
+}
+
+type ReturnDetail struct {
+	ProductID   int64   `json:"productId"`
+	ProductCode string  `json:"productCode"`
+	ProductName string  `json:"productName"`
+	Quantity    float64 `json:"quantity"`
+	Price       float64 `json:"price"`
+	SubTotal    float64 `json:"subTotal"`
+	Note        string  `json:"note"`
+}
+
+type PurchaseOrderPage struct {
+	Total          int64           `json:"total"`
+	PageSize       int64           `json:"pageSize"`
+	PurchaseOrders []PurchaseOrder `json:"data"`
+}
+
+// PurchaseOrder is a receipt of goods from a supplier, its lines are only complete when returned by GetPurchaseOrder
+type PurchaseOrder struct {
+	ID                   int64                 `json:"id"`
+	Code                 string                `json:"code"`
+	PurchaseDate         *KiotTime             `json:"purchaseDate"`
+	BranchID             int64                 `json:"branchId"`
+	BranchName           string                `json:"branchName"`
+	SupplierID           *int64                `json:"supplierId"`
+	SupplierCode         string                `json:"supplierCode"`
+	SupplierName         string                `json:"supplierName"`
+	PurchaseByID         int64                 `json:"purchaseById"`
+	PurchaseName         string                `json:"purchaseName"`
+	Total                float64               `json:"total"`
+	TotalPayment         float64               `json:"totalPayment"`
+	Discount             float64               `json:"discount"`
+	Status               int                   `json:"status"`
+	Description          string                `json:"description"`
+	RetailerID           int64                 `json:"retailerId"`
+	CreatedDate          *KiotTime             `json:"createdDate"`
+	ModifiedDate         *KiotTime             `json:"modifiedDate"`
+	PurchaseOrderDetails []PurchaseOrderDetail `json:"purchaseOrderDetails"`
+}
+
+type PurchaseOrderDetail struct {
+	ProductID     int64   `json:"productId"`
+	ProductCode   string  `json:"productCode"`
+	ProductName   string  `json:"productName"`
+	Quantity      float64 `json:"quantity"`
+	Price         float64 `json:"price"`
+	Discount      float64 `json:"discount"`
+	SerialNumbers string  `json:"serialNumbers"`
+}
+
+type BranchPage struct {
+	Total    int64    `json:"total"`
+	PageSize int64    `json:"pageSize"`
+	Branches []Branch `json:"data"`
+}
+
+type Branch struct {
+	ID            int64     `json:"id"`
+	BranchName    string    `json:"branchName"`
+	BranchCode    string    `json:"branchCode"`
+	ContactNumber string    `json:"contactNumber"`
+	Address       string    `json:"address"`
+	LocationName  string    `json:"locationName"`
+	WardName      string    `json:"wardName"`
+	Email         string    `json:"email"`
+	RetailerID    int64     `json:"retailerId"`
+	CreatedDate   *KiotTime `json:"createdDate"`
+	ModifiedDate  *KiotTime `json:"modifiedDate"`
+}
+
+type UserPage struct {
+	Total    int64  `json:"total"`
+	PageSize int64  `json:"pageSize"`
+	Users    []User `json:"data"`
+}
+
+type User struct {
+	ID           int64     `json:"id"`
+	UserName     string    `json:"userName"`
+	GivenName    string    `json:"givenName"`
+	Description  string    `json:"description"`
+	RetailerID   int64     `json:"retailerId"`
+	CreatedDate  *KiotTime `json:"createdDate"`
+	ModifiedDate *KiotTime `json:"modifiedDate"`
+}
+
+type CategoryPage struct {
+	Total      int64      `json:"total"`
+	PageSize   int64      `json:"pageSize"`
+	Categories []Category `json:"data"`
+}
+
+type Category struct {
+	CategoryID   int64     `json:"categoryId"`
+	CategoryName string    `json:"categoryName"`
+	ParentID     *int64    `json:"parentId"`
+	HasChild     bool      `json:"hasChild"`
+	RetailerID   int64     `json:"retailerId"`
+	CreatedDate  *KiotTime `json:"createdDate"`
+	ModifiedDate *KiotTime `json:"modifiedDate"`
+}
+
+type SupplierPage struct {
+	Total     int64      `json:"total"`
+	PageSize  int64      `json:"pageSize"`
+	Suppliers []Supplier `json:"data"`
+}
+
+type Supplier struct {
+	ID            int64     `json:"id"`
+	Code          string    `json:"code"`
+	Name          string    `json:"name"`
+	ContactNumber string    `json:"contactNumber"`
+	Email         string    `json:"email"`
+	Address       string    `json:"address"`
+	LocationName  string    `json:"locationName"`
+	WardName      string    `json:"wardName"`
+	Organization  string    `json:"organization"`
+	TaxCode       string    `json:"taxCode"`
+	Comments      string    `json:"comments"`
+	Debt          float64   `json:"debt"`
+	TotalInvoiced float64   `json:"totalInvoiced"`
+	IsActive      bool      `json:"isActive"`
+	BranchID      *int64    `json:"branchId"`
+	RetailerID    int64     `json:"retailerId"`
+	CreatedDate   *KiotTime `json:"createdDate"`
+	ModifiedDate  *KiotTime `json:"modifiedDate"`
+}
+
+type CustomerPage struct {
+	Total     int64      `json:"total"`
+	PageSize  int64      `json:"pageSize"`
+	Customers []Customer `json:"data"`
+}
+
+type Customer struct {
+	ID            int64     `json:"id"`
+	Code          string    `json:"code"`
+	Name          string    `json:"name"`
+	Gender        *bool     `json:"gender"`
+	ContactNumber string    `json:"contactNumber"`
+	Email         string    `json:"email"`
+	Address       string    `json:"address"`
+	LocationName  string    `json:"locationName"`
+	WardName      string    `json:"wardName"`
+	Organization  string    `json:"organization"`
+	TaxCode       string    `json:"taxCode"`
+	Comments      string    `json:"comments"`
+	Groups        string    `json:"groups"`
+	Debt          float64   `json:"debt"`
+	TotalInvoiced float64   `json:"totalInvoiced"`
+	TotalPoint    float64   `json:"totalPoint"`
+	TotalRevenue  float64   `json:"totalRevenue"`
+	BranchID      *int64    `json:"branchId"`
+	RetailerID    int64     `json:"retailerId"`
+	CreatedDate   *KiotTime `json:"createdDate"`
+	ModifiedDate  *KiotTime `json:"modifiedDate"`
+}
+
+// WebhookRegistration subscribes url to the notifications of a webhook type, e.g. product.update
+type WebhookRegistration struct {
+	Type        string `json:"Type"`
+	URL         string `json:"Url"`
+	IsActive    bool   `json:"IsActive"`
+	Description string `json:"Description"`
+	Secret      string `json:"Secret"`
+}
+
+// WebhookPayload is the body of a webhook call, an Action is the webhook type suffixed by the retailer id
+type WebhookPayload struct {
+	ID            string                `json:"Id"`
+	Attempt       int                   `json:"Attempt"`
+	Notifications []WebhookNotification `json:"Notifications"`
+}
+
+type WebhookNotification struct {
+	Action string          `json:"Action"`
+	Data   json.RawMessage `json:"Data"`
+}
+
 // Structs returned from Web APIs
 
 type WebAccessToken struct {
@@ -99,7 +479,13 @@ func (t *KiotTime) UnmarshalJSON(data []byte) error {
 	case reflect.String:
 		parsedTime, err := time.Parse(KiotTimeLayout, items.String())
 		if err != nil {
-			return err
+			// webhooks send the local time with its offset, only the local time is kept like the other dates
+			withOffset, offsetErr := time.Parse(time.RFC3339Nano, items.String())
+			if offsetErr != nil {
+				return err
+			}
+			parsedTime = time.Date(withOffset.Year(), withOffset.Month(), withOffset.Day(), withOffset.Hour(),
+				withOffset.Minute(), withOffset.Second(), withOffset.Nanosecond(), time.UTC)
 		}
 		t.t = parsedTime
 		return nil
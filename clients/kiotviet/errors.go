@@ -0,0 +1,66 @@
+package kiotviet
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// APIError is a response of KiotViet with an error status, decoded from its responseStatus when it has one
+type APIError struct {
+	Path       string
+	StatusCode int
+	ErrorCode  string
+	Message    string
+	// Body is the raw response, for the errors without responseStatus
+	Body string
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("error calling %s, status %d, %s: %s", e.Path, e.StatusCode, e.ErrorCode, e.Message)
+	}
+	return fmt.Sprintf("error calling %s, status %d: %s", e.Path, e.StatusCode, e.Body)
+}
+
+// Temporary tells if the call may succeed when made again later
+func (e *APIError) Temporary() bool {
+	return retryableStatus(e.StatusCode)
+}
+
+// errorResponse is the body of the errors of the public API
+type errorResponse struct {
+	ResponseStatus struct {
+		ErrorCode string `json:"errorCode"`
+		Message   string `json:"message"`
+	} `json:"responseStatus"`
+}
+
+func newAPIError(path string, statusCode int, body []byte) *APIError {
+	apiErr := &APIError{
+		Path:       path,
+		StatusCode: statusCode,
+		Body:       string(body),
+	}
+	var errResp errorResponse
+	if err := json.Unmarshal(body, &errResp); err == nil {
+		apiErr.ErrorCode = errResp.ResponseStatus.ErrorCode
+		apiErr.Message = errResp.ResponseStatus.Message
+	}
+	return apiErr
+}
+
+func retryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// retryable tells if a call can be made again after its response or error, only a 429 ensures the call wasn't processed
+func retryable(resp *http.Response, err error, idempotent bool) bool {
+	if err != nil {
+		return idempotent
+	}
+	if idempotent {
+		return retryableStatus(resp.StatusCode)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests
+}
@@ -0,0 +1,120 @@
+package kiotviet
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tokenExpiryMargin is how long before its expiry a token is refreshed, so no call is made with an expired token
+const tokenExpiryMargin = 5 * time.Minute
+
+// token is an access token with the cookies of the web login, a zero ExpiresAt never expires
+type token struct {
+	Value     string         `json:"value"`
+	Cookies   []*http.Cookie `json:"cookies,omitempty"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+}
+
+func (t *token) valid(now time.Time) bool {
+	return t != nil && t.Value != "" && (t.ExpiresAt.IsZero() || now.Add(tokenExpiryMargin).Before(t.ExpiresAt))
+}
+
+// tokenSource shares a token between the goroutines of a client. The lock is held while the token is fetched, so a
+// single fetch happens at a time and the goroutines waiting for it use the token it returns
+type tokenSource struct {
+	name  string
+	fetch func(ctx context.Context) (*token, error)
+	// cachePath is the file the token is kept in between runs, no cache when empty
+	cachePath string
+
+	lock   sync.Mutex
+	token  *token
+	loaded bool
+}
+
+func newTokenSource(name string, cacheDir string, retailer string, fetch func(ctx context.Context) (*token, error)) *tokenSource {
+	s := &tokenSource{name: name, fetch: fetch}
+	if cacheDir != "" {
+		s.cachePath = filepath.Join(cacheDir, retailer+"_"+name+"_token.json")
+	}
+	return s
+}
+
+// Token returns the current token, fetched again when it is missing, about to expire or is stale,
+// i.e. KiotViet refused the call made with it
+func (s *tokenSource) Token(ctx context.Context, stale *token) (*token, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.loaded {
+		s.loaded = true
+		s.token = s.load()
+	}
+	// another goroutine refreshed the stale token while this one was waiting for the lock
+	if s.token.valid(time.Now()) && (stale == nil || stale.Value != s.token.Value) {
+		return s.token, nil
+	}
+
+	t, err := s.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.token = t
+	s.save(t)
+	return t, nil
+}
+
+func (s *tokenSource) load() *token {
+	if s.cachePath == "" {
+		return nil
+	}
+	content, err := os.ReadFile(s.cachePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithFields(log.Fields{
+				"path":  s.cachePath,
+				"error": err,
+			}).Warnln("error reading cached KiotViet token")
+		}
+		return nil
+	}
+	var t token
+	if err := json.Unmarshal(content, &t); err != nil {
+		log.WithFields(log.Fields{
+			"path":  s.cachePath,
+			"error": err,
+		}).Warnln("invalid cached KiotViet token, ignoring it")
+		return nil
+	}
+	return &t
+}
+
+func (s *tokenSource) save(t *token) {
+	if s.cachePath == "" {
+		return
+	}
+	content, err := json.Marshal(t)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(s.cachePath), 0700)
+	}
+	if err == nil {
+		// the file is renamed once written so a concurrent run never reads a partial token
+		tmpPath := s.cachePath + ".tmp"
+		if err = os.WriteFile(tmpPath, content, 0600); err == nil {
+			err = os.Rename(tmpPath, s.cachePath)
+		}
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path":  s.cachePath,
+			"error": err,
+		}).Warnln("error caching KiotViet token")
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"db-sync/config"
 	"db-sync/data"
 	"fmt"
+	"strings"
 
+	"cloud.google.com/go/bigquery"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 )
@@ -130,3 +132,42 @@ func (c *Client) GetRows(ctx context.Context, tableName string, limit int64, off
 	}
 	return rows, nil
 }
+
+// GetChecksum aggregates the table into the checksum compared with the rows synced into BigQuery, see data.Checksum
+func (c *Client) GetChecksum(ctx context.Context, tableName string, columns []data.Column, keyColumns []string) (*data.Checksum, error) {
+	var keys []string
+	for _, key := range keyColumns {
+		keys = append(keys, fmt.Sprintf(`"%s"::text`, key))
+	}
+	aggregates := []string{
+		"COUNT(*)",
+		fmt.Sprintf(`COALESCE(SUM(('x' || substr(md5(concat_ws('|', %s)), 1, 8))::bit(32)::bigint), 0)::bigint`, strings.Join(keys, ", ")),
+	}
+
+	checksum := &data.Checksum{Source: data.SourcePostgres, Columns: make(map[string]data.ColumnChecksum)}
+	values := []interface{}{&checksum.Rows, &checksum.KeyChecksum}
+	nonNulls := make([]int64, len(columns))
+	sums := make([]float64, len(columns))
+	numerics := make([]bool, len(columns))
+	for i, column := range columns {
+		aggregates = append(aggregates, fmt.Sprintf(`COUNT("%s")`, column.Name))
+		values = append(values, &nonNulls[i])
+
+		bqType, err := data.PostgresDataTypeToBQ(column.DataType)
+		if err == nil && (bqType == bigquery.IntegerFieldType || bqType == bigquery.FloatFieldType) {
+			numerics[i] = true
+			aggregates = append(aggregates, fmt.Sprintf(`COALESCE(SUM("%s"), 0)::float8`, column.Name))
+			values = append(values, &sums[i])
+		}
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM "%s"`, strings.Join(aggregates, ", "), tableName)
+	if err := c.QueryRowxContext(ctx, query).Scan(values...); err != nil {
+		return nil, err
+	}
+
+	for i, column := range columns {
+		checksum.Columns[column.Name] = data.ColumnChecksum{NonNull: nonNulls[i], Sum: sums[i], Numeric: numerics[i]}
+	}
+	return checksum, nil
+}
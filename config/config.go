@@ -21,3 +21,58 @@ var KiotVietClientSecret = os.Getenv("KIOTVIET_CLIENT_SECRET")
 var KiotVietRetailer = os.Getenv("KIOTVIET_RETAILER")
 var KiotVietUserName = os.Getenv("KIOTVIET_USERNAME")
 var KiotVietPassWord = os.Getenv("KIOTVIET_PASSWORD")
+
+// KiotVietInitialLookbackDays is how far back the first incremental run and the backfills list KiotViet documents,
+// 60 days when empty
+var KiotVietInitialLookbackDays = os.Getenv("KIOTVIET_INITIAL_LOOKBACK_DAYS")
+
+// KiotVietWebhookSecret signs the KiotViet webhooks, the signatures are not checked when empty
+var KiotVietWebhookSecret = os.Getenv("KIOTVIET_WEBHOOK_SECRET")
+
+// KiotVietRateLimit is the number of calls per second to KiotViet, 5 when empty and unlimited when 0
+var KiotVietRateLimit = os.Getenv("KIOTVIET_RATE_LIMIT")
+
+// KiotVietMaxRetries is the number of times a KiotViet call failing with 429, 5xx or a network error is made again,
+// 5 when empty
+var KiotVietMaxRetries = os.Getenv("KIOTVIET_MAX_RETRIES")
+
+// KiotVietTokenCacheDir keeps the KiotViet tokens and login cookies between runs, they are not cached when empty
+var KiotVietTokenCacheDir = os.Getenv("KIOTVIET_TOKEN_CACHE_DIR")
+
+var BqWriteMode = os.Getenv("BQ_WRITE_MODE")
+var BqLoadFileFormat = os.Getenv("BQ_LOAD_FILE_FORMAT")
+var BqLoadTempDir = os.Getenv("BQ_LOAD_TEMP_DIR")
+
+// BqMaximumBytesBilled caps the bytes billed by each merge job, no cap when empty
+var BqMaximumBytesBilled = os.Getenv("BQ_MAXIMUM_BYTES_BILLED")
+
+var BqDeadLetterDestination = os.Getenv("BQ_DEAD_LETTER_DESTINATION")
+var BqDeadLetterDir = os.Getenv("BQ_DEAD_LETTER_DIR")
+
+var BqLocation = os.Getenv("BQ_LOCATION")
+var SyncTimezone = os.Getenv("SYNC_TIMEZONE")
+var BqPresyncExpirationDays = os.Getenv("BQ_PRESYNC_EXPIRATION_DAYS")
+
+// Pipelines can override the BigQuery destination settings above by prefixing them with their name, e.g. KIOTVIET_BQ_LOCATION
+const (
+	PipelineWebDB    = "WEBDB"
+	PipelineKiotViet = "KIOTVIET"
+)
+
+func PipelineSetting(pipeline string, name string, global string) string {
+	if v := os.Getenv(pipeline + "_" + name); v != "" {
+		return v
+	}
+	return global
+}
+
+var BqTableOptionsFile = os.Getenv("BQ_TABLE_OPTIONS_FILE")
+
+// SyncValidate enables the comparison of row counts and checksums between Postgres and BigQuery after each merge
+var SyncValidate = os.Getenv("SYNC_VALIDATE") == "true"
+
+// SyncModelsDir is the directory of the SQL models run after the merges, see models.Model
+var SyncModelsDir = os.Getenv("SYNC_MODELS_DIR")
+
+// BqModelsDataset is where the models are materialized, the websync dataset of the web database by default
+var BqModelsDataset = os.Getenv("BQ_MODELS_DATASET")
@@ -0,0 +1,74 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Checksum aggregates a table into numbers that can be computed the same way in Postgres and in BigQuery
+type Checksum struct {
+	Source Source
+	Rows   int64
+	// KeyChecksum is the sum of the first 32 bits of the MD5 of the keys cast to text
+	KeyChecksum int64
+	Columns     map[string]ColumnChecksum
+}
+
+type ColumnChecksum struct {
+	NonNull int64
+	// Sum is only computed for numeric columns
+	Sum     float64
+	Numeric bool
+}
+
+type ChecksumDelta struct {
+	Metric      string
+	Source      string
+	Destination string
+}
+
+func (d ChecksumDelta) String() string {
+	return fmt.Sprintf("%s: %s != %s", d.Metric, d.Source, d.Destination)
+}
+
+// sumTolerance absorbs the float rounding differences between the sums of the two engines
+const sumTolerance = 1e-9
+
+// Diff compares the checksum of the source with the checksum of the destination
+func (c *Checksum) Diff(destination *Checksum) []ChecksumDelta {
+	var deltas []ChecksumDelta
+	if c.Rows != destination.Rows {
+		deltas = append(deltas, ChecksumDelta{Metric: "rows", Source: strconv.FormatInt(c.Rows, 10), Destination: strconv.FormatInt(destination.Rows, 10)})
+	}
+	if c.KeyChecksum != destination.KeyChecksum {
+		deltas = append(deltas, ChecksumDelta{Metric: "key_checksum", Source: strconv.FormatInt(c.KeyChecksum, 10), Destination: strconv.FormatInt(destination.KeyChecksum, 10)})
+	}
+
+	var columnNames []string
+	for name := range c.Columns {
+		columnNames = append(columnNames, name)
+	}
+	sort.Strings(columnNames)
+	for _, name := range columnNames {
+		source := c.Columns[name]
+		dest, ok := destination.Columns[name]
+		if !ok {
+			deltas = append(deltas, ChecksumDelta{Metric: name + " column", Source: "present", Destination: "missing"})
+			continue
+		}
+		if source.NonNull != dest.NonNull {
+			deltas = append(deltas, ChecksumDelta{Metric: name + " non null", Source: strconv.FormatInt(source.NonNull, 10), Destination: strconv.FormatInt(dest.NonNull, 10)})
+		}
+		if source.Numeric && !sumEqual(source.Sum, dest.Sum) {
+			deltas = append(deltas, ChecksumDelta{Metric: name + " sum", Source: strconv.FormatFloat(source.Sum, 'g', -1, 64), Destination: strconv.FormatFloat(dest.Sum, 'g', -1, 64)})
+		}
+	}
+
+	return deltas
+}
+
+func sumEqual(a float64, b float64) bool {
+	return math.Abs(a-b) <= sumTolerance*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
@@ -0,0 +1,42 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksumDiff(t *testing.T) {
+	assert := assert.New(t)
+	source := &Checksum{
+		Rows:        3,
+		KeyChecksum: 1234,
+		Columns: map[string]ColumnChecksum{
+			"price": {NonNull: 3, Sum: 0.3, Numeric: true},
+			"name":  {NonNull: 2},
+		},
+	}
+	destination := &Checksum{
+		Rows:        3,
+		KeyChecksum: 1234,
+		Columns: map[string]ColumnChecksum{
+			"price": {NonNull: 3, Sum: 0.3 + 1e-12, Numeric: true},
+			"name":  {NonNull: 2},
+		},
+	}
+	assert.Empty(source.Diff(destination))
+
+	destination.Rows = 2
+	destination.KeyChecksum = 1000
+	destination.Columns["name"] = ColumnChecksum{NonNull: 1}
+	destination.Columns["price"] = ColumnChecksum{NonNull: 2, Sum: 0.1, Numeric: true}
+	deltas := source.Diff(destination)
+	assert.Equal([]ChecksumDelta{
+		{Metric: "rows", Source: "3", Destination: "2"},
+		{Metric: "key_checksum", Source: "1234", Destination: "1000"},
+		{Metric: "name non null", Source: "2", Destination: "1"},
+		{Metric: "price non null", Source: "3", Destination: "2"},
+		{Metric: "price sum", Source: "0.3", Destination: "0.1"},
+	}, deltas)
+	assert.Equal("rows: 3 != 2", deltas[0].String())
+}
@@ -0,0 +1,61 @@
+package data
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// ConvertValue converts a value which went through JSON (a replayed dead-letter row for example)
+// back to the Go type we stream for the BigQuery field type
+func ConvertValue(fieldType bigquery.FieldType, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch fieldType {
+	case bigquery.IntegerFieldType:
+		switch v := value.(type) {
+		case float64:
+			return int64(v), nil
+		case string:
+			return strconv.ParseInt(v, 10, 64)
+		}
+	case bigquery.FloatFieldType:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			return strconv.ParseFloat(v, 64)
+		}
+	case bigquery.BooleanFieldType:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(v)
+		}
+	case bigquery.TimestampFieldType:
+		switch v := value.(type) {
+		case string:
+			return time.Parse(time.RFC3339Nano, v)
+		case float64:
+			return time.Unix(int64(v), 0), nil
+		}
+	case bigquery.StringFieldType:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+	default:
+		return value, nil
+	}
+
+	return nil, fmt.Errorf("cannot convert %v (%T) to Bigquery type %s", value, value, fieldType)
+}
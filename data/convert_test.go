@@ -0,0 +1,36 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertValue(t *testing.T) {
+	assert := assert.New(t)
+
+	v, err := ConvertValue(bigquery.IntegerFieldType, float64(12))
+	assert.Nil(err)
+	assert.Equal(int64(12), v)
+
+	v, err = ConvertValue(bigquery.FloatFieldType, "10.5")
+	assert.Nil(err)
+	assert.Equal(10.5, v)
+
+	v, err = ConvertValue(bigquery.TimestampFieldType, "2022-07-01T18:40:40+07:00")
+	assert.Nil(err)
+	assert.True(v.(time.Time).Equal(time.Date(2022, 7, 1, 11, 40, 40, 0, time.UTC)))
+
+	v, err = ConvertValue(bigquery.StringFieldType, float64(123))
+	assert.Nil(err)
+	assert.Equal("123", v)
+
+	v, err = ConvertValue(bigquery.IntegerFieldType, nil)
+	assert.Nil(err)
+	assert.Nil(v)
+
+	_, err = ConvertValue(bigquery.IntegerFieldType, "abc")
+	assert.NotNil(err)
+}
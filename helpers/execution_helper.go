@@ -9,6 +9,6 @@ import (
 func Elapsed(l *logrus.Entry) func() {
 	start := time.Now()
 	return func() {
-		l.Infoln("function took %v", time.Since(start))
+		l.Infof("function took %v", time.Since(start))
 	}
 }
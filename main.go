@@ -6,11 +6,14 @@ import (
 	"db-sync/clients/kiotviet"
 	"db-sync/clients/webdatabases"
 	"db-sync/config"
-	"db-sync/data"
+	"db-sync/models"
 	"db-sync/streaming"
+	"flag"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
+	_ "time/tzdata"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -26,6 +29,39 @@ func startUp() {
 func main() {
 	ctx := context.Background()
 	startUp()
+
+	command := "sync"
+	var args []string
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+		args = os.Args[2:]
+	}
+
+	switch command {
+	case "sync":
+		runSync(ctx, args)
+	case "replay":
+		runReplay(ctx, args)
+	case "backfill":
+		runBackfill(ctx, args)
+	case "serve":
+		runServe(ctx, args)
+	default:
+		log.Errorf("unknown command %s, expected sync, replay, backfill or serve", command)
+	}
+}
+
+// runSync streams the tables into the presync datasets and merges them
+//
+//	db-sync sync [-dry-run]
+func runSync(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "stream into the presync datasets but only estimate the bytes processed by the merges instead of running them")
+	if err := flags.Parse(args); err != nil {
+		log.Errorln(err)
+		return
+	}
+
 	dbClient, err := webdatabases.NewClient()
 	if err != nil {
 		log.Errorln(err)
@@ -52,11 +88,30 @@ func main() {
 		return
 	}
 
+	webDBDest, err := bigqueryclient.NewDestination(config.PipelineWebDB)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	kiotvietDest, err := bigqueryclient.NewDestination(config.PipelineKiotViet)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	runID := bigqueryclient.NewRunID()
+	webDBRun := bigqueryclient.NewRun(runID, webDBDest)
+	kiotvietRun := bigqueryclient.NewRun(runID, kiotvietDest)
+	webDBRun.DryRun = *dryRun
+	kiotvietRun.DryRun = *dryRun
+
 	log.WithFields(log.Fields{
 		"tables": tables,
+		"runID":  runID,
+		"dryRun": *dryRun,
 	}).Infoln("streaming tables to BQ")
-	streamingService := streaming.NewWebDBToBQStreaming(bqClient, dbClient, batchSize, tables)
-	kiotvietService := streaming.NewKiotVietStreaming(bqClient, kiotvietClient)
+	streamingService := streaming.NewWebDBToBQStreaming(bqClient, dbClient, webDBRun, batchSize, tables)
+	kiotvietService := streaming.NewKiotVietStreaming(bqClient, kiotvietClient, kiotvietRun)
 
 	err = streamingService.Stream(ctx)
 	if err != nil {
@@ -66,20 +121,73 @@ func main() {
 	} else {
 		log.Infoln("done streaming tables from web database into BQ")
 	}
+	streamingService.Summary().Log()
+
+	kiotvietJobs := []struct {
+		name   string
+		stream func(ctx context.Context) error
+	}{
+		// the users are synced first to name the creators of the transfers
+		{"reference data", kiotvietService.StreamReferenceData},
+		{"transfers", kiotvietService.StreamTransfers},
+		{"products", kiotvietService.StreamProducts},
+		{"invoices", kiotvietService.StreamInvoices},
+		{"orders", kiotvietService.StreamOrders},
+		{"returns", kiotvietService.StreamReturns},
+		{"purchase orders", kiotvietService.StreamPurchaseOrders},
+	}
+	for _, job := range kiotvietJobs {
+		if err := job.stream(ctx); err != nil {
+			log.WithFields(log.Fields{
+				"job":   job.name,
+				"error": err,
+			}).Errorln("error streaming from KiotViet into BQ")
+		} else {
+			log.WithFields(log.Fields{
+				"job": job.name,
+			}).Infoln("done streaming from KiotViet into BQ")
+		}
+	}
+	kiotvietService.Summary().Log()
+
+	runModels(ctx, bqClient, webDBRun, map[*bigqueryclient.Destination]*streaming.RunSummary{
+		webDBDest:    streamingService.Summary(),
+		kiotvietDest: kiotvietService.Summary(),
+	})
+}
 
-	err = kiotvietService.StreamTransfers(ctx)
+// runModels materializes the SQL models once the tables they depend on are merged
+func runModels(ctx context.Context, bqClient *bigqueryclient.Client, run *bigqueryclient.Run, summaries map[*bigqueryclient.Destination]*streaming.RunSummary) {
+	modelList, err := models.LoadModels(config.SyncModelsDir)
 	if err != nil {
 		log.Errorln(err)
+		return
+	}
+	if len(modelList) == 0 {
+		return
+	}
+
+	tables := make(map[string]models.SyncedTable)
+	for dest, summary := range summaries {
+		for _, table := range summary.Tables() {
+			tables[table.Table] = models.SyncedTable{
+				Dataset:   dest.Dataset,
+				Location:  dest.Location,
+				Succeeded: table.Error == "" && (table.Merged || run.DryRun),
+			}
+		}
+	}
+
+	dataset := config.BqModelsDataset
+	if dataset == "" {
+		dataset = run.Dest.Dataset
 	}
+	_, err = models.NewRunner(bqClient, run, dataset, tables).Run(ctx, modelList)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
-		}).Errorln("error streaming from KiotViet into BQ")
-	} else {
-		log.Infoln("done streaming from KiotViet into BQ")
+		}).Errorln("error running models")
 	}
-
-	return
 }
 
 func createTableWrapper() {
@@ -97,147 +205,19 @@ func createTransferTable() {
 	}
 	defer bqClient.Close()
 
-	ctx := context.Background()
-	tableName := "kiotviet_transfers"
-	columnDef := []data.Column{
-		{
-			Name:     "id",
-			DataType: "int",
-			NullAble: false,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "code",
-			DataType: "string",
-			NullAble: false,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "from_branch_id",
-			DataType: "int",
-			NullAble: true,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "to_branch_id",
-			DataType: "int",
-			NullAble: true,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "status",
-			DataType: "int",
-			NullAble: true,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "transfer_date",
-			DataType: "time",
-			NullAble: true,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "received_date",
-			DataType: "time",
-			NullAble: true,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "retailer_id",
-			DataType: "int",
-			NullAble: true,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "sent_note",
-			DataType: "string",
-			NullAble: true,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "received_note",
-			DataType: "string",
-			NullAble: true,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "product_id",
-			DataType: "int",
-			NullAble: false,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "product_code",
-			DataType: "string",
-			NullAble: false,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "product_name",
-			DataType: "string",
-			NullAble: false,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "sent_quantity",
-			DataType: "int",
-			NullAble: true,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "received_quantity",
-			DataType: "int",
-			NullAble: true,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "sent_price",
-			DataType: "float64",
-			NullAble: true,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "received_price",
-			DataType: "float64",
-			NullAble: true,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "price",
-			DataType: "float64",
-			NullAble: true,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "sent_imei_serials",
-			DataType: "string",
-			NullAble: true,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "received_imei_serials",
-			DataType: "string",
-			NullAble: true,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "created_user_name",
-			DataType: "string",
-			NullAble: true,
-			From:     data.ColumnFromKiotViet,
-		},
-		{
-			Name:     "barcode",
-			DataType: "string",
-			NullAble: true,
-			From:     data.ColumnFromKiotViet,
-		},
+	dest, err := bigqueryclient.NewDestination(config.PipelineKiotViet)
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
 
-	err = bqClient.CreateSyncTimePartitionTable(ctx, config.BqWebsyncDataset, config.BqPresyncDataset, strings.ToLower(tableName), columnDef)
+	ctx := context.Background()
+	report, err := bqClient.EnsureSyncTimePartitionTable(ctx, dest, streaming.KiotvietTransferTable, streaming.TransferColumns)
 	if err != nil {
 		fmt.Println(err)
+		return
 	}
+	report.Log()
 }
 
 func creatTable() error {
@@ -260,7 +240,17 @@ func creatTable() error {
 	}
 	defer bqClient.Close()
 
-	return bqClient.CreateSyncTimePartitionTable(ctx, config.BqWebsyncDataset, config.BqPresyncDataset, strings.ToLower(tableName), columnDef)
+	dest, err := bigqueryclient.NewDestination(config.PipelineWebDB)
+	if err != nil {
+		return err
+	}
+
+	report, err := bqClient.EnsureSyncTimePartitionTable(ctx, dest, strings.ToLower(tableName), columnDef)
+	if err != nil {
+		return err
+	}
+	report.Log()
+	return nil
 }
 
 func getRowDb() error {
@@ -282,5 +272,11 @@ func getRowDb() error {
 	}
 	defer bqClient.Close()
 
-	return bqClient.InsertOrUpdate(ctx, config.BqPresyncDataset, "products", rows)
+	dest, err := bigqueryclient.NewDestination(config.PipelineWebDB)
+	if err != nil {
+		return err
+	}
+
+	_, err = bqClient.InsertOrUpdate(ctx, bigqueryclient.NewRun(bigqueryclient.NewRunID(), dest), "products", rows)
+	return err
 }
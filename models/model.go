@@ -0,0 +1,148 @@
+package models
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type Materialization string
+
+const (
+	MaterializedTable Materialization = "table"
+	MaterializedView  Materialization = "view"
+)
+
+// Model is a SQL transformation building a reporting table from the synced tables and other models.
+// A model is a <name>.sql file of a SELECT statement templated with text/template, declaring its dependencies
+// and how it is materialized in its leading comments:
+//
+//	-- depends_on: kiotviet_transfers, products
+//	-- materialized: table
+//	SELECT ... FROM {{ latest "kiotviet_transfers" }} JOIN {{ ref "stock_base" }} USING (product_id)
+//
+// table refers to a synced table, latest to its <table>_latest view and ref to another model, all must be declared
+// in depends_on. The _date partitions of the incremental KiotViet tables only hold the documents modified since the
+// previous run, a model needing every document reads the latest view rather than the partition of {{ .SyncDate }}
+type Model struct {
+	Name         string
+	DependsOn    []string
+	Materialized Materialization
+	SQL          string
+}
+
+// LoadModels reads the models of the directory, an empty dir means no models
+func LoadModels(dir string) ([]*Model, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var models []*Model
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".sql")
+		model, err := ParseModel(name, string(content))
+		if err != nil {
+			return nil, fmt.Errorf("invalid model %s: %v", path, err)
+		}
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+// ParseModel reads the declarations of the leading comments of the model
+func ParseModel(name string, content string) (*Model, error) {
+	model := &Model{Name: strings.ToLower(name), Materialized: MaterializedTable, SQL: content}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+
+		declaration := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(line, "--")), ":", 2)
+		if len(declaration) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(declaration[1])
+		switch strings.TrimSpace(declaration[0]) {
+		case "depends_on":
+			for _, dependency := range strings.Split(value, ",") {
+				if dependency = strings.ToLower(strings.TrimSpace(dependency)); dependency != "" {
+					model.DependsOn = append(model.DependsOn, dependency)
+				}
+			}
+		case "materialized":
+			model.Materialized = Materialization(strings.ToLower(value))
+		}
+	}
+
+	if model.Materialized != MaterializedTable && model.Materialized != MaterializedView {
+		return nil, fmt.Errorf("materialization %s not supported yet", model.Materialized)
+	}
+	return model, nil
+}
+
+// Sort orders the models so every model comes after the models it depends on. Dependencies which are not models
+// are synced tables and don't constrain the order
+func Sort(models []*Model) ([]*Model, error) {
+	byName := make(map[string]*Model)
+	for _, model := range models {
+		if _, ok := byName[model.Name]; ok {
+			return nil, fmt.Errorf("model %s is defined twice", model.Name)
+		}
+		byName[model.Name] = model
+	}
+
+	var sorted []*Model
+	// 0: not visited, 1: being visited, 2: sorted
+	state := make(map[string]int)
+	var visit func(model *Model, path []string) error
+	visit = func(model *Model, path []string) error {
+		switch state[model.Name] {
+		case 1:
+			return fmt.Errorf("models depend on each other: %s", strings.Join(append(path, model.Name), " -> "))
+		case 2:
+			return nil
+		}
+
+		state[model.Name] = 1
+		for _, dependency := range model.DependsOn {
+			if upstream, ok := byName[dependency]; ok {
+				if err := visit(upstream, append(path, model.Name)); err != nil {
+					return err
+				}
+			}
+		}
+		state[model.Name] = 2
+		sorted = append(sorted, model)
+		return nil
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := visit(byName[name], nil); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	biqueryclient "db-sync/clients/bigquery"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseModel(t *testing.T) {
+	assert := assert.New(t)
+	model, err := ParseModel("Stock_Movements", "-- depends_on: kiotviet_transfers, Products\n-- materialized: view\n\nSELECT 1\n-- materialized: table\n")
+	assert.Nil(err)
+	assert.Equal("stock_movements", model.Name)
+	assert.Equal([]string{"kiotviet_transfers", "products"}, model.DependsOn)
+	assert.Equal(MaterializedView, model.Materialized)
+
+	model, err = ParseModel("daily", "SELECT 1")
+	assert.Nil(err)
+	assert.Empty(model.DependsOn)
+	assert.Equal(MaterializedTable, model.Materialized)
+
+	_, err = ParseModel("daily", "-- materialized: incremental\nSELECT 1")
+	assert.NotNil(err)
+}
+
+func TestSort(t *testing.T) {
+	assert := assert.New(t)
+	report := &Model{Name: "report", DependsOn: []string{"stock", "products"}}
+	stock := &Model{Name: "stock", DependsOn: []string{"base"}}
+	base := &Model{Name: "base", DependsOn: []string{"kiotviet_transfers"}}
+
+	sorted, err := Sort([]*Model{report, stock, base})
+	assert.Nil(err)
+	assert.Equal([]*Model{base, stock, report}, sorted)
+
+	base.DependsOn = []string{"report"}
+	_, err = Sort([]*Model{report, stock, base})
+	assert.EqualError(err, "models depend on each other: base -> report -> stock -> base")
+
+	_, err = Sort([]*Model{stock, {Name: "stock"}})
+	assert.NotNil(err)
+}
+
+func TestRunnerRenderAndUpstream(t *testing.T) {
+	assert := assert.New(t)
+	run := biqueryclient.NewRun("run-1", &biqueryclient.Destination{Dataset: "websync", Timezone: time.UTC})
+	r := NewRunner(nil, run, "reporting", map[string]SyncedTable{
+		"kiotviet_transfers": {Dataset: "kiotviet", Succeeded: true},
+		"products":           {Dataset: "websync", Succeeded: false},
+	})
+
+	model := &Model{Name: "stock", DependsOn: []string{"kiotviet_transfers", "base"}, SQL: `SELECT * FROM {{ table "kiotviet_transfers" }} JOIN {{ ref "base" }} USING (id) WHERE _date = DATE "{{ .SyncDate }}"`}
+	sql, err := r.Render(model)
+	assert.Nil(err)
+	assert.Equal("SELECT * FROM `kiotviet.kiotviet_transfers` JOIN `reporting.base` USING (id) WHERE _date = DATE \""+run.SyncDate.String()+"\"", sql)
+
+	_, err = r.Render(&Model{Name: "undeclared", SQL: `SELECT * FROM {{ table "kiotviet_transfers" }}`})
+	assert.NotNil(err)
+
+	sql, err = r.Render(&Model{Name: "current", DependsOn: []string{"kiotviet_transfers"}, SQL: `SELECT * FROM {{ latest "kiotviet_transfers" }}`})
+	assert.Nil(err)
+	assert.Equal("SELECT * FROM `kiotviet.kiotviet_transfers_latest`", sql)
+	_, err = r.Render(&Model{Name: "undeclared", SQL: `SELECT * FROM {{ latest "kiotviet_transfers" }}`})
+	assert.NotNil(err)
+
+	assert.Nil(r.checkUpstream(model, map[string]bool{"base": true}))
+	assert.EqualError(r.checkUpstream(model, map[string]bool{"base": false}), "upstream model base failed")
+	assert.EqualError(r.checkUpstream(&Model{Name: "p", DependsOn: []string{"products"}}, nil), "upstream table products failed")
+	assert.EqualError(r.checkUpstream(&Model{Name: "o", DependsOn: []string{"orders"}}, nil), "dependency orders is neither a model nor a synced table")
+}
+
+func TestRunnerDryRunAndLocation(t *testing.T) {
+	assert := assert.New(t)
+	run := biqueryclient.NewRun("run-1", &biqueryclient.Destination{Dataset: "websync", Timezone: time.UTC})
+	r := NewRunner(nil, run, "reporting", map[string]SyncedTable{
+		"kiotviet_transfers": {Dataset: "kiotviet", Location: "asia-southeast1", Succeeded: true},
+		"products":           {Dataset: "websync", Location: "US", Succeeded: true},
+	})
+	r.location = "asia-southeast1"
+
+	base := &Model{Name: "base", DependsOn: []string{"kiotviet_transfers"}}
+	stock := &Model{Name: "stock", DependsOn: []string{"kiotviet_transfers", "base"}}
+	assert.Nil(r.checkDryRun(stock, map[string]bool{"base": true}))
+	run.DryRun = true
+	assert.Nil(r.checkDryRun(base, nil))
+	assert.EqualError(r.checkDryRun(stock, map[string]bool{"base": true}), "upstream model base is not materialized by dry runs")
+
+	assert.Nil(r.checkLocation(stock))
+	assert.EqualError(r.checkLocation(&Model{Name: "p", DependsOn: []string{"products"}}), "table products is in US while the models dataset reporting is in asia-southeast1")
+}
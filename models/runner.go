@@ -0,0 +1,220 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	biqueryclient "db-sync/clients/bigquery"
+	"db-sync/helpers"
+	"fmt"
+	"strings"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type ModelStatus string
+
+const (
+	ModelSucceeded ModelStatus = "succeeded"
+	ModelFailed    ModelStatus = "failed"
+	// ModelSkipped models depend on a table or a model which failed
+	ModelSkipped ModelStatus = "skipped"
+)
+
+type ModelResult struct {
+	Model  string
+	Status ModelStatus
+	Error  string
+}
+
+// SyncedTable is a table of the run a model can depend on
+type SyncedTable struct {
+	Dataset string
+	// Location of the dataset, the models can only read the tables in the location of the models dataset
+	Location string
+	// Succeeded is false when the table failed to sync or merge, its downstream models are skipped
+	Succeeded bool
+}
+
+// Runner materializes the models into the models dataset after the merges of a run
+type Runner struct {
+	bqClient *biqueryclient.Client
+	run      *biqueryclient.Run
+	dataset  string
+	// location of the models dataset, where the queries materializing the models run
+	location string
+	tables   map[string]SyncedTable
+}
+
+func NewRunner(bqClient *biqueryclient.Client, run *biqueryclient.Run, dataset string, tables map[string]SyncedTable) *Runner {
+	return &Runner{
+		bqClient: bqClient,
+		run:      run,
+		dataset:  dataset,
+		tables:   tables,
+	}
+}
+
+// Run materializes the models in dependency order. A model whose synced tables or upstream models failed is skipped
+func (r *Runner) Run(ctx context.Context, models []*Model) ([]ModelResult, error) {
+	sorted, err := Sort(models)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := r.bqClient.Dataset(r.dataset).Metadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the location of the models dataset %s: %v", r.dataset, err)
+	}
+	r.location = metadata.Location
+
+	var results []ModelResult
+	succeeded := make(map[string]bool)
+	for _, model := range sorted {
+		result := ModelResult{Model: model.Name, Status: ModelSucceeded}
+		if err := r.checkDryRun(model, succeeded); err != nil {
+			result.Status = ModelSkipped
+			result.Error = err.Error()
+		} else if err := r.checkUpstream(model, succeeded); err != nil {
+			result.Status = ModelSkipped
+			result.Error = err.Error()
+		} else if err := r.checkLocation(model); err != nil {
+			result.Status = ModelFailed
+			result.Error = err.Error()
+		} else if err := r.runModel(ctx, model); err != nil {
+			result.Status = ModelFailed
+			result.Error = err.Error()
+		}
+
+		succeeded[model.Name] = result.Status == ModelSucceeded
+		logEntry := log.WithFields(log.Fields{
+			"model":  model.Name,
+			"status": result.Status,
+			"error":  result.Error,
+		})
+		if result.Status == ModelSucceeded {
+			logEntry.Infoln("done running model")
+		} else {
+			logEntry.Warnln("model not run")
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// checkUpstream returns an error for the first dependency of the model which didn't succeed
+func (r *Runner) checkUpstream(model *Model, succeeded map[string]bool) error {
+	for _, dependency := range model.DependsOn {
+		if ok, isModel := succeeded[dependency]; isModel {
+			if !ok {
+				return fmt.Errorf("upstream model %s failed", dependency)
+			}
+			continue
+		}
+
+		table, ok := r.tables[dependency]
+		if !ok {
+			return fmt.Errorf("dependency %s is neither a model nor a synced table", dependency)
+		}
+		if !table.Succeeded {
+			return fmt.Errorf("upstream table %s failed", dependency)
+		}
+	}
+	return nil
+}
+
+// checkDryRun returns an error for the models depending on another model in a dry run: the models are not
+// materialized, their dry run would fail or validate against the models of a previous run
+func (r *Runner) checkDryRun(model *Model, models map[string]bool) error {
+	if !r.run.DryRun {
+		return nil
+	}
+	for _, dependency := range model.DependsOn {
+		if _, isModel := models[dependency]; isModel {
+			return fmt.Errorf("upstream model %s is not materialized by dry runs", dependency)
+		}
+	}
+	return nil
+}
+
+// checkLocation returns an error for the first synced table of the model outside the location of the models dataset,
+// a query can't read datasets of several locations
+func (r *Runner) checkLocation(model *Model) error {
+	for _, dependency := range model.DependsOn {
+		table, ok := r.tables[dependency]
+		if ok && table.Location != "" && r.location != "" && !strings.EqualFold(table.Location, r.location) {
+			return fmt.Errorf("table %s is in %s while the models dataset %s is in %s", dependency, table.Location, r.dataset, r.location)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) runModel(ctx context.Context, model *Model) error {
+	sql, err := r.Render(model)
+	if err != nil {
+		return err
+	}
+
+	statement := "TABLE"
+	if model.Materialized == MaterializedView {
+		statement = "VIEW"
+	}
+	q := r.bqClient.Query(fmt.Sprintf("CREATE OR REPLACE %s %s AS\n%s", statement, r.modelTable(model.Name), sql))
+	q.Location = r.location
+	if r.run.DryRun {
+		// the dry run validates the model against the current tables without materializing it
+		q.DryRun = true
+		_, err := q.Run(ctx)
+		return err
+	}
+	return helpers.RunQuery(ctx, q)
+}
+
+// Render executes the template of the model. table and ref only resolve the dependencies declared by the model
+func (r *Runner) Render(model *Model) (string, error) {
+	declared := make(map[string]bool)
+	for _, dependency := range model.DependsOn {
+		declared[dependency] = true
+	}
+
+	funcs := template.FuncMap{
+		"table": func(name string) (string, error) {
+			synced, ok := r.tables[name]
+			if !ok || !declared[name] {
+				return "", fmt.Errorf("table %s is not a synced table declared in depends_on", name)
+			}
+			return biqueryclient.QuoteIdentifier(fmt.Sprintf("%s.%s", synced.Dataset, name)), nil
+		},
+		"latest": func(name string) (string, error) {
+			synced, ok := r.tables[name]
+			if !ok || !declared[name] {
+				return "", fmt.Errorf("table %s is not a synced table declared in depends_on", name)
+			}
+			return biqueryclient.QuoteIdentifier(fmt.Sprintf("%s.%s%s", synced.Dataset, name, biqueryclient.LatestViewSuffix)), nil
+		},
+		"ref": func(name string) (string, error) {
+			if !declared[name] {
+				return "", fmt.Errorf("model %s is not declared in depends_on", name)
+			}
+			return r.modelTable(name), nil
+		},
+	}
+
+	t, err := template.New(model.Name).Funcs(funcs).Parse(model.SQL)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	err = t.Execute(buf, map[string]interface{}{
+		"RunID":    r.run.ID,
+		"SyncDate": r.run.SyncDate,
+		"Dataset":  r.dataset,
+	})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (r *Runner) modelTable(name string) string {
+	return biqueryclient.QuoteIdentifier(fmt.Sprintf("%s.%s", r.dataset, name))
+}
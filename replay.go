@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	bigqueryclient "db-sync/clients/bigquery"
+	"db-sync/clients/webdatabases"
+	"db-sync/config"
+	"db-sync/streaming"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// runReplay re-sends dead-lettered rows, either from the dead-letter files or from the dead-letter table
+//
+//	db-sync replay [-from-table] [-table products] [-run-id ID] [-convert]
+func runReplay(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	fromTable := flags.Bool("from-table", false, "read the records from the _dead_letter table in the presync dataset instead of the dead-letter files")
+	tableName := flags.String("table", "", "only replay the rows of this BigQuery table")
+	runID := flags.String("run-id", "", "only replay the rows rejected in this run (dead-letter table only)")
+	convert := flags.Bool("convert", false, "re-apply the current type conversion before inserting")
+	if err := flags.Parse(args); err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	bqClient, err := bigqueryclient.NewClient()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	defer bqClient.Close()
+
+	batchSize, err := strconv.ParseInt(config.StreamingBatchSize, 10, 64)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	webDBDest, err := bigqueryclient.NewDestination(config.PipelineWebDB)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	kiotvietDest, err := bigqueryclient.NewDestination(config.PipelineKiotViet)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	// the records are read first so Postgres is only connected to when rows of its tables are replayed
+	var records []bigqueryclient.DeadLetterRecord
+	fileRecords := make(map[string][]bigqueryclient.DeadLetterRecord)
+	var files []string
+	if *fromTable {
+		readDatasets := make(map[string]bool)
+		for _, dest := range []*bigqueryclient.Destination{webDBDest, kiotvietDest} {
+			if readDatasets[dest.PresyncDataset] {
+				continue
+			}
+			readDatasets[dest.PresyncDataset] = true
+			destRecords, err := bqClient.ReadDeadLetterTable(ctx, dest, *tableName, *runID)
+			if err != nil {
+				log.Errorln(err)
+				return
+			}
+			records = append(records, destRecords...)
+		}
+	} else {
+		files, err = deadLetterFiles(*tableName, webDBDest, kiotvietDest)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		for _, file := range files {
+			fileRecords[file], err = bigqueryclient.ReadDeadLetterFile(file)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"file":  file,
+					"error": err,
+				}).Errorln("error reading dead-letter file")
+				continue
+			}
+			records = append(records, fileRecords[file]...)
+		}
+	}
+
+	var dbClient *webdatabases.Client
+	if streaming.NeedsWebDB(records) {
+		dbClient, err = webdatabases.NewClient()
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		defer dbClient.Close()
+	}
+
+	tables := strings.Split(config.StreamingDbTables, config.Separator)
+	// the replay is a run of its own so the merges only pick the replayed rows
+	replayRunID := bigqueryclient.NewRunID()
+	log.WithField("runID", replayRunID).Infoln("replaying dead-lettered rows")
+	replayService := streaming.NewDeadLetterReplay(bqClient, dbClient, webDBDest, kiotvietDest, batchSize, tables, replayRunID, *convert)
+
+	if *fromTable {
+		replayed, err := replayService.Replay(ctx, records)
+		if err != nil {
+			log.Errorln(err)
+		}
+		// the replayed rows are recorded so the next replay doesn't send them again
+		if err := bqClient.MarkDeadLetterReplayed(ctx, replayRunID, replayed); err != nil {
+			log.WithField("error", err).Errorln("error recording the replayed dead-lettered rows")
+		}
+		replayService.Summary().Log()
+		return
+	}
+
+	for _, file := range files {
+		if len(fileRecords[file]) == 0 {
+			continue
+		}
+		replayed, err := replayService.Replay(ctx, fileRecords[file])
+		if err != nil {
+			log.WithFields(log.Fields{
+				"file":  file,
+				"error": err,
+			}).Errorln("error replaying dead-letter file")
+		}
+		if err := archiveDeadLetterFile(file, fileRecords[file], replayed); err != nil {
+			log.WithFields(log.Fields{
+				"file":  file,
+				"error": err,
+			}).Errorln("error archiving replayed dead-lettered rows")
+		}
+	}
+	replayService.Summary().Log()
+}
+
+// archiveDeadLetterFile moves the replayed records of the file into a .replayed-* file. The records which failed
+// again and the rows rejected during the replay, appended after the records read, stay in the file
+func archiveDeadLetterFile(file string, records []bigqueryclient.DeadLetterRecord, replayed []bigqueryclient.DeadLetterRecord) error {
+	if len(replayed) == 0 {
+		return nil
+	}
+	current, err := bigqueryclient.ReadDeadLetterFile(file)
+	if err != nil {
+		return err
+	}
+
+	replayedKeys := make(map[string]bool)
+	for _, record := range replayed {
+		replayedKeys[record.Key()] = true
+	}
+	var archived, kept []bigqueryclient.DeadLetterRecord
+	for i, record := range current {
+		if i < len(records) && replayedKeys[record.Key()] {
+			archived = append(archived, record)
+		} else {
+			kept = append(kept, record)
+		}
+	}
+
+	replayedFile := fmt.Sprintf("%s.replayed-%s", file, time.Now().Format("20060102150405"))
+	if err := bigqueryclient.WriteDeadLetterFile(replayedFile, archived); err != nil {
+		return err
+	}
+	return bigqueryclient.WriteDeadLetterFile(file, kept)
+}
+
+func deadLetterFiles(tableName string, dests ...*bigqueryclient.Destination) ([]string, error) {
+	dir := config.BqDeadLetterDir
+	if dir == "" {
+		dir = bigqueryclient.DefaultDeadLetterDir
+	}
+	if tableName == "" {
+		return filepath.Glob(filepath.Join(dir, "*.ndjson"))
+	}
+
+	var files []string
+	for _, dest := range dests {
+		file := bigqueryclient.DeadLetterFile(dir, dest.PresyncDataset, tableName)
+		if _, err := os.Stat(file); err == nil {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	bigqueryclient "db-sync/clients/bigquery"
+	"db-sync/clients/kiotviet"
+	"db-sync/config"
+	"db-sync/streaming"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// runServe receives the KiotViet webhooks, streams them into the presync dataset and merges them every interval.
+// It refuses to start without KIOTVIET_WEBHOOK_SECRET, unless -insecure is given to post recorded payloads locally
+// without signature
+//
+//	db-sync serve [-addr :8080] [-merge-interval 5m] [-register https://example.com/kiotviet/webhook]
+//	db-sync serve -insecure
+//	curl -X POST --data @streaming/testdata/webhooks/product_update.json localhost:8080/kiotviet/webhook
+func runServe(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", ":8080", "address to listen on")
+	mergeInterval := flags.Duration("merge-interval", 5*time.Minute, "interval between two merges of the rows received")
+	registerURL := flags.String("register", "", "public URL of the webhook endpoint to register in KiotViet before serving, needs KIOTVIET_WEBHOOK_SECRET")
+	insecure := flags.Bool("insecure", false, "accept the webhooks without checking their signature when KIOTVIET_WEBHOOK_SECRET is not set, for local tests only")
+	if err := flags.Parse(args); err != nil {
+		log.Errorln(err)
+		return
+	}
+	if config.KiotVietWebhookSecret == "" {
+		// anyone could post rows into BigQuery, even with -insecure KiotViet is never told to call an unsigned endpoint
+		if *registerURL != "" {
+			log.Errorln("KIOTVIET_WEBHOOK_SECRET is required to register the webhooks")
+			return
+		}
+		if !*insecure {
+			log.Errorln("KIOTVIET_WEBHOOK_SECRET is not set, pass -insecure to accept unsigned webhooks")
+			return
+		}
+		log.Warnln("KIOTVIET_WEBHOOK_SECRET is not set, accepting unsigned webhooks")
+	}
+
+	bqClient, err := bigqueryclient.NewClient()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	defer bqClient.Close()
+	dest, err := bigqueryclient.NewDestination(config.PipelineKiotViet)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	if *registerURL != "" {
+		kiotvietClient, err := kiotviet.NewClient()
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		for _, webhookType := range streaming.WebhookTypes {
+			err := kiotvietClient.RegisterWebhook(ctx, kiotviet.WebhookRegistration{
+				Type:        webhookType,
+				URL:         *registerURL,
+				IsActive:    true,
+				Description: "db-sync",
+				Secret:      config.KiotVietWebhookSecret,
+			})
+			if err != nil {
+				log.WithFields(log.Fields{
+					"type":  webhookType,
+					"error": err,
+				}).Errorln("error registering KiotViet webhook")
+				return
+			}
+		}
+	}
+
+	receiver := streaming.NewWebhookReceiver(bqClient, dest, config.KiotVietWebhookSecret, *insecure)
+	if err := receiver.EnsureTables(ctx); err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	mux := http.NewServeMux()
+	mux.Handle("/kiotviet/webhook", receiver)
+	server := &http.Server{Addr: *addr, Handler: mux}
+
+	stopped := make(chan struct{})
+	go receiver.Run(ctx, *mergeInterval)
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Errorln(err)
+		}
+	}()
+
+	log.WithFields(log.Fields{
+		"addr":          *addr,
+		"mergeInterval": *mergeInterval,
+	}).Infoln("receiving KiotViet webhooks")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Errorln(err)
+		stop()
+	}
+	// the in-flight handlers have returned once the server is shut down, their rows are merged before exiting
+	<-stopped
+	receiver.Merge(context.Background())
+}
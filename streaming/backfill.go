@@ -0,0 +1,217 @@
+package streaming
+
+import (
+	"context"
+	biqueryclient "db-sync/clients/bigquery"
+	"db-sync/clients/kiotviet"
+	"db-sync/clients/webdatabases"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/civil"
+	log "github.com/sirupsen/logrus"
+)
+
+// BackfillState records the partitions a backfill already rebuilt so an interrupted backfill resumes where it stopped
+type BackfillState struct {
+	path string
+	// Done maps the BigQuery table names to the sync dates rebuilt
+	Done map[string][]string `json:"done"`
+}
+
+// LoadBackfillState reads the state file, a missing file is an empty state
+func LoadBackfillState(path string) (*BackfillState, error) {
+	state := &BackfillState{path: path, Done: make(map[string][]string)}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("invalid backfill state file %s: %v", path, err)
+	}
+	return state, nil
+}
+
+func (s *BackfillState) IsDone(tableName string, date civil.Date) bool {
+	for _, done := range s.Done[tableName] {
+		if done == date.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkDone records the partition and saves the state
+func (s *BackfillState) MarkDone(tableName string, date civil.Date) error {
+	s.Done[tableName] = append(s.Done[tableName], date.String())
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write then rename so an interrupted backfill never leaves a truncated state
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Backfill rebuilds the _date partitions of a table for a range of past sync dates. Every date is a run of its own
+// streaming what the daily sync would have streamed into presync, then merged into its partition
+type Backfill struct {
+	bqClient       *biqueryclient.Client
+	webDBClient    *webdatabases.Client
+	kiotVietClient *kiotviet.Client
+	webDBDest      *biqueryclient.Destination
+	kiotVietDest   *biqueryclient.Destination
+	batchSize      int64
+	tables         []string
+	// pause between two partitions to spare the source
+	pause   time.Duration
+	state   *BackfillState
+	summary *RunSummary
+}
+
+func NewBackfill(bqClient *biqueryclient.Client, webDBClient *webdatabases.Client, kiotVietClient *kiotviet.Client, webDBDest *biqueryclient.Destination, kiotVietDest *biqueryclient.Destination, batchSize int64, tables []string, pause time.Duration, state *BackfillState) *Backfill {
+	return &Backfill{
+		bqClient:       bqClient,
+		webDBClient:    webDBClient,
+		kiotVietClient: kiotVietClient,
+		webDBDest:      webDBDest,
+		kiotVietDest:   kiotVietDest,
+		batchSize:      batchSize,
+		tables:         tables,
+		pause:          pause,
+		state:          state,
+		summary:        NewRunSummary(),
+	}
+}
+
+func (b *Backfill) Summary() *RunSummary {
+	return b.summary
+}
+
+// Backfill rebuilds the partitions of tableName from from to to included. It stops at the first failing partition,
+// running it again skips the partitions already rebuilt
+func (b *Backfill) Backfill(ctx context.Context, tableName string, from civil.Date, to civil.Date) error {
+	if to.Before(from) {
+		return fmt.Errorf("backfill range %s to %s is empty", from, to)
+	}
+
+	bqTableName := strings.ToLower(tableName)
+	dest, originalTableName, err := b.destination(bqTableName)
+	if err != nil {
+		return err
+	}
+	if dest.TableOptions(bqTableName).Strategy() == biqueryclient.MergeStrategySCD2 {
+		return fmt.Errorf("table %s keeps its history with the scd2 merge strategy, past partitions can't be rebuilt", bqTableName)
+	}
+	if err := b.checkPostgresRange(bqTableName, from); err != nil {
+		return err
+	}
+
+	runID := biqueryclient.NewRunID()
+	for date := from; !date.After(to); date = date.AddDays(1) {
+		logEntry := log.WithFields(log.Fields{
+			"tableName": bqTableName,
+			"date":      date,
+			"runID":     runID,
+		})
+		if b.state.IsDone(bqTableName, date) {
+			logEntry.Infoln("partition already backfilled, skipping")
+			continue
+		}
+
+		run, err := biqueryclient.NewBackfillRun(runID, dest, date)
+		if err != nil {
+			return err
+		}
+
+		logEntry.Infoln("start backfilling partition")
+		if err := b.backfillPartition(ctx, run, originalTableName); err != nil {
+			return fmt.Errorf("error backfilling %s of %s: %v", date, bqTableName, err)
+		}
+		if err := b.state.MarkDone(bqTableName, date); err != nil {
+			return err
+		}
+		logEntry.Infoln("done backfilling partition")
+
+		if date.Before(to) && b.pause > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(b.pause):
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *Backfill) backfillPartition(ctx context.Context, run *biqueryclient.Run, originalTableName string) error {
+	var summary *RunSummary
+	var err error
+	if _, ok := findKiotVietTable(originalTableName); ok {
+		s := NewKiotVietStreaming(b.bqClient, b.kiotVietClient, run)
+		err = s.StreamTableUntil(ctx, originalTableName, run.EndOfSyncDate())
+		summary = s.Summary()
+	} else {
+		s := NewWebDBToBQStreaming(b.bqClient, b.webDBClient, run, b.batchSize, []string{originalTableName})
+		err = s.StreamTable(ctx, originalTableName)
+		summary = s.Summary()
+	}
+
+	var failed []string
+	for _, table := range summary.Tables() {
+		b.summary.add(table)
+		if table.Failed() {
+			failed = append(failed, table.Table)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	// a partition with failed batches would be incomplete, it is rebuilt by the next backfill
+	if len(failed) > 0 {
+		return fmt.Errorf("rows of %s were not synced", strings.Join(failed, ","))
+	}
+	return nil
+}
+
+// checkPostgresRange refuses the past dates of Postgres tables. Postgres only holds the current rows, rebuilding a past
+// partition from them would overwrite the snapshot of that date with the rows of today. KiotViet documents are
+// streamed up to the end of the date from their modification dates
+func (b *Backfill) checkPostgresRange(bqTableName string, from civil.Date) error {
+	if _, ok := findKiotVietTable(bqTableName); ok {
+		return nil
+	}
+	today := civil.DateOf(time.Now().In(b.webDBDest.Timezone))
+	if from.Before(today) {
+		return fmt.Errorf("table %s is synced from Postgres which only holds its current rows, only the partition of today %s can be rebuilt", bqTableName, today)
+	}
+	return nil
+}
+
+// destination returns the destination of the pipeline streaming the table and the name of the table in the source
+func (b *Backfill) destination(bqTableName string) (*biqueryclient.Destination, string, error) {
+	if _, ok := findKiotVietTable(bqTableName); ok {
+		return b.kiotVietDest, bqTableName, nil
+	}
+
+	// Postgres table names are case sensitive while BigQuery tables are lower cased
+	for _, originalTableName := range b.tables {
+		if strings.ToLower(originalTableName) == bqTableName {
+			return b.webDBDest, originalTableName, nil
+		}
+	}
+
+	return nil, "", fmt.Errorf("table %s is not streamed, cannot backfill it", bqTableName)
+}
@@ -0,0 +1,40 @@
+package streaming
+
+import (
+	biqueryclient "db-sync/clients/bigquery"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackfillState(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "backfill_state.json")
+	date := civil.Date{Year: 2022, Month: 7, Day: 1}
+
+	state, err := LoadBackfillState(path)
+	assert.Nil(err)
+	assert.False(state.IsDone("products", date))
+	assert.Nil(state.MarkDone("products", date))
+
+	state, err = LoadBackfillState(path)
+	assert.Nil(err)
+	assert.True(state.IsDone("products", date))
+	assert.False(state.IsDone("products", date.AddDays(1)))
+	assert.False(state.IsDone("kiotviet_transfers", date))
+}
+
+func TestBackfillPostgresPastDates(t *testing.T) {
+	assert := assert.New(t)
+	webDBDest := &biqueryclient.Destination{Dataset: "web_sync", Timezone: time.UTC}
+	kiotVietDest := &biqueryclient.Destination{Dataset: "kiotviet_sync", Timezone: time.UTC}
+	b := NewBackfill(nil, nil, nil, webDBDest, kiotVietDest, 100, []string{"Products"}, 0, nil)
+	today := civil.DateOf(time.Now().In(time.UTC))
+
+	assert.NotNil(b.checkPostgresRange("products", today.AddDays(-1)))
+	assert.Nil(b.checkPostgresRange("products", today))
+	assert.Nil(b.checkPostgresRange(KiotvietProductTable, today.AddDays(-1)))
+}
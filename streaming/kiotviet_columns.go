@@ -0,0 +1,1494 @@
+package streaming
+
+import "db-sync/data"
+
+// TransferColumns is the schema of the kiotviet_transfers table, one row per transfer detail
+var TransferColumns = []data.Column{
+	{
+		Name:     "id",
+		DataType: "int",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "_sub_id",
+		DataType: "int",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "code",
+		DataType: "string",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "from_branch_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "to_branch_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "status",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "transfer_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "received_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "retailer_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "sent_note",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "received_note",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "product_id",
+		DataType: "int",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "product_code",
+		DataType: "string",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "product_name",
+		DataType: "string",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "sent_quantity",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "received_quantity",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "sent_price",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "received_price",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "price",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "sent_imei_serials",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "received_imei_serials",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "created_by_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "created_user_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "barcode",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+}
+
+// ProductColumns is the schema of the kiotviet_products table, price_books is the JSON of the price books of the product
+var ProductColumns = []data.Column{
+	{
+		Name:     "id",
+		DataType: "int",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "code",
+		DataType: "string",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "bar_code",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "name",
+		DataType: "string",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "full_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "category_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "category_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "allows_sale",
+		DataType: "bool",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "type",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "has_variants",
+		DataType: "bool",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "base_price",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "weight",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "unit",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "master_product_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "master_unit_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "conversion_value",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "description",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "is_active",
+		DataType: "bool",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "retailer_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "created_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "modified_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "price_books",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+}
+
+// InventoryColumns is the schema of the kiotviet_inventories table, the on-hand inventory of a product in a branch
+var InventoryColumns = []data.Column{
+	{
+		Name:     "product_id",
+		DataType: "int",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "branch_id",
+		DataType: "int",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "product_code",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "branch_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "cost",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "on_hand",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "reserved",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "min_quantity",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "max_quantity",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "on_order",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+}
+
+// InvoiceColumns is the schema of the kiotviet_invoices table, payments is the JSON of the payments of the invoice
+var InvoiceColumns = []data.Column{
+	{
+		Name:     "id",
+		DataType: "int",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "uuid",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "code",
+		DataType: "string",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "purchase_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "branch_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "branch_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "sold_by_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "sold_by_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "customer_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "customer_code",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "customer_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "order_code",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "total",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "total_payment",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "discount",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "status",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "status_value",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "description",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "using_cod",
+		DataType: "bool",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "retailer_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "created_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "modified_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "payments",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+}
+
+// InvoiceDetailColumns is the schema of the kiotviet_invoice_details table, one row per invoice line
+var InvoiceDetailColumns = []data.Column{
+	{
+		Name:     "id",
+		DataType: "int",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "_sub_id",
+		DataType: "int",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "code",
+		DataType: "string",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "purchase_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "branch_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "product_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "product_code",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "product_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "quantity",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "price",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "discount",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "discount_ratio",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "sub_total",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "note",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "serial_numbers",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+}
+
+// OrderColumns is the schema of the kiotviet_orders table, one row per order line, a row with a null _sub_id
+// for the orders without lines
+var OrderColumns = []data.Column{
+	{
+		Name:     "id",
+		DataType: "int",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "_sub_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "code",
+		DataType: "string",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "purchase_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "branch_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "branch_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "sold_by_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "sold_by_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "customer_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "customer_code",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "customer_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "total",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "total_payment",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "status",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "status_value",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "description",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "retailer_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "created_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "modified_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "product_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "product_code",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "product_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "quantity",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "price",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "discount",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "discount_ratio",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "note",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+}
+
+// ReturnColumns is the schema of the kiotviet_returns table, one row per returned line, a row with a null _sub_id
+// for the returns without lines
+var ReturnColumns = []data.Column{
+	{
+		Name:     "id",
+		DataType: "int",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "_sub_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "code",
+		DataType: "string",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "invoice_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "return_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "branch_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "branch_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "received_by_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "sold_by_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "customer_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "customer_code",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "customer_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "return_total",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "return_discount",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "return_fee",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "total_payment",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "status",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "status_value",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "retailer_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "created_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "modified_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "product_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "product_code",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "product_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "quantity",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "price",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "sub_total",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "note",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+}
+
+// PurchaseOrderColumns is the schema of the kiotviet_purchase_orders table, one row per received line, a row with
+// a null _sub_id for the purchase orders without lines
+var PurchaseOrderColumns = []data.Column{
+	{
+		Name:     "id",
+		DataType: "int",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "_sub_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "code",
+		DataType: "string",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "purchase_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "branch_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "branch_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "supplier_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "supplier_code",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "supplier_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "purchase_by_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "purchase_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "total",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "total_payment",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "status",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "description",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "retailer_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "created_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "modified_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "product_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "product_code",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "product_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "quantity",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "price",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "discount",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "serial_numbers",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+}
+
+// BranchColumns is the schema of the kiotviet_branches table
+var BranchColumns = []data.Column{
+	{
+		Name:     "id",
+		DataType: "int",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "branch_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "branch_code",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "contact_number",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "address",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "location_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "ward_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "email",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "retailer_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "created_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "modified_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+}
+
+// UserColumns is the schema of the kiotviet_users table
+var UserColumns = []data.Column{
+	{
+		Name:     "id",
+		DataType: "int",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "user_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "given_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "description",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "retailer_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "created_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "modified_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+}
+
+// CategoryColumns is the schema of the kiotviet_categories table, the categories flattened with their parent
+var CategoryColumns = []data.Column{
+	{
+		Name:     "category_id",
+		DataType: "int",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "category_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "parent_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "has_child",
+		DataType: "bool",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "retailer_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "created_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "modified_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+}
+
+// SupplierColumns is the schema of the kiotviet_suppliers table
+var SupplierColumns = []data.Column{
+	{
+		Name:     "id",
+		DataType: "int",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "code",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "contact_number",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "email",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "address",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "location_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "ward_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "organization",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "tax_code",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "comments",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "debt",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "total_invoiced",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "is_active",
+		DataType: "bool",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "branch_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "retailer_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "created_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "modified_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+}
+
+// CustomerColumns is the schema of the kiotviet_customers table
+var CustomerColumns = []data.Column{
+	{
+		Name:     "id",
+		DataType: "int",
+		NullAble: false,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "code",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "gender",
+		DataType: "bool",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "contact_number",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "email",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "address",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "location_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "ward_name",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "organization",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "tax_code",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "comments",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "debt",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "total_invoiced",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "total_point",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "total_revenue",
+		DataType: "float64",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "groups",
+		DataType: "string",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "branch_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "retailer_id",
+		DataType: "int",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "created_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+	{
+		Name:     "modified_date",
+		DataType: "time",
+		NullAble: true,
+		From:     data.ColumnFromKiotViet,
+	},
+}
+
+func columnNames(columns []data.Column) []string {
+	var names []string
+	for _, c := range columns {
+		names = append(names, c.Name)
+	}
+	return names
+}
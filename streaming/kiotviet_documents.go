@@ -0,0 +1,439 @@
+package streaming
+
+import (
+	"context"
+	"db-sync/clients/kiotviet"
+	"db-sync/config"
+	"db-sync/data"
+	"db-sync/helpers"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	KiotvietOrderTable         = "kiotviet_orders"
+	KiotvietReturnTable        = "kiotviet_returns"
+	KiotvietPurchaseOrderTable = "kiotviet_purchase_orders"
+)
+
+const (
+	ListDocumentsLimit     = 100
+	ListDocumentsBatchSize = 500
+)
+
+// documentLinesKeyColumns identify a line of a document, like a transfer detail
+var documentLinesKeyColumns = []string{"id", "_sub_id"}
+
+// document is a KiotViet document listed by page whose lines are fetched one document at a time
+type document struct {
+	id   int64
+	date *kiotviet.KiotTime
+	// rows fetches the lines of the document and converts them into one row per line
+	rows func(ctx context.Context) ([]data.Row, error)
+}
+
+// listDocuments returns a page of the documents modified since lastModifiedFrom by descending id, no documents once
+// the pages are exhausted
+type listDocuments func(ctx context.Context, lastModifiedFrom time.Time, limit int, offset int) ([]document, error)
+
+// StreamOrders streams the orders modified since the last succeeded run, then merges and audits them
+func (s *KiotVietStreaming) StreamOrders(ctx context.Context) error {
+	return s.streamOrders(ctx, time.Now(), true)
+}
+
+// StreamOrdersUntil streams the orders modified in the initial lookback before until and purchased before until
+func (s *KiotVietStreaming) StreamOrdersUntil(ctx context.Context, until time.Time) error {
+	return s.streamOrders(ctx, until, false)
+}
+
+func (s *KiotVietStreaming) streamOrders(ctx context.Context, until time.Time, incremental bool) error {
+	list := func(ctx context.Context, lastModifiedFrom time.Time, limit int, offset int) ([]document, error) {
+		page, err := s.kiotVietClient.ListOrders(ctx, lastModifiedFrom, limit, offset)
+		if err != nil {
+			return nil, err
+		}
+		var documents []document
+		for _, order := range page.Orders {
+			id := order.ID
+			documents = append(documents, document{
+				id:   id,
+				date: order.PurchaseDate,
+				rows: func(ctx context.Context) ([]data.Row, error) {
+					order, err := s.kiotVietClient.GetOrder(ctx, id)
+					if err != nil {
+						return nil, err
+					}
+					return orderToRows(*order), nil
+				},
+			})
+		}
+		return documents, nil
+	}
+	return s.streamDocumentsUntil(ctx, KiotvietOrderTable, list, until, incremental)
+}
+
+// StreamReturns streams the returns modified since the last succeeded run, then merges and audits them
+func (s *KiotVietStreaming) StreamReturns(ctx context.Context) error {
+	return s.streamReturns(ctx, time.Now(), true)
+}
+
+// StreamReturnsUntil streams the returns modified in the initial lookback before until and returned before until
+func (s *KiotVietStreaming) StreamReturnsUntil(ctx context.Context, until time.Time) error {
+	return s.streamReturns(ctx, until, false)
+}
+
+func (s *KiotVietStreaming) streamReturns(ctx context.Context, until time.Time, incremental bool) error {
+	list := func(ctx context.Context, lastModifiedFrom time.Time, limit int, offset int) ([]document, error) {
+		page, err := s.kiotVietClient.ListReturns(ctx, lastModifiedFrom, limit, offset)
+		if err != nil {
+			return nil, err
+		}
+		var documents []document
+		for _, r := range page.Returns {
+			id := r.ID
+			documents = append(documents, document{
+				id:   id,
+				date: r.ReturnDate,
+				rows: func(ctx context.Context) ([]data.Row, error) {
+					r, err := s.kiotVietClient.GetReturn(ctx, id)
+					if err != nil {
+						return nil, err
+					}
+					return returnToRows(*r), nil
+				},
+			})
+		}
+		return documents, nil
+	}
+	return s.streamDocumentsUntil(ctx, KiotvietReturnTable, list, until, incremental)
+}
+
+// StreamPurchaseOrders streams the purchase orders modified since the last succeeded run, then merges and audits them
+func (s *KiotVietStreaming) StreamPurchaseOrders(ctx context.Context) error {
+	return s.streamPurchaseOrders(ctx, time.Now(), true)
+}
+
+// StreamPurchaseOrdersUntil streams the purchase orders modified in the initial lookback before until and purchased
+// before until
+func (s *KiotVietStreaming) StreamPurchaseOrdersUntil(ctx context.Context, until time.Time) error {
+	return s.streamPurchaseOrders(ctx, until, false)
+}
+
+func (s *KiotVietStreaming) streamPurchaseOrders(ctx context.Context, until time.Time, incremental bool) error {
+	list := func(ctx context.Context, lastModifiedFrom time.Time, limit int, offset int) ([]document, error) {
+		page, err := s.kiotVietClient.ListPurchaseOrders(ctx, lastModifiedFrom, limit, offset)
+		if err != nil {
+			return nil, err
+		}
+		var documents []document
+		for _, purchaseOrder := range page.PurchaseOrders {
+			id := purchaseOrder.ID
+			documents = append(documents, document{
+				id:   id,
+				date: purchaseOrder.PurchaseDate,
+				rows: func(ctx context.Context) ([]data.Row, error) {
+					purchaseOrder, err := s.kiotVietClient.GetPurchaseOrder(ctx, id)
+					if err != nil {
+						return nil, err
+					}
+					return purchaseOrderToRows(*purchaseOrder), nil
+				},
+			})
+		}
+		return documents, nil
+	}
+	return s.streamDocumentsUntil(ctx, KiotvietPurchaseOrderTable, list, until, incremental)
+}
+
+func (s *KiotVietStreaming) streamDocumentsUntil(ctx context.Context, tableName string, list listDocuments, until time.Time, incremental bool) error {
+	s.summary.Start(tableName)
+	err := s.streamDocuments(ctx, tableName, list, until, incremental)
+	auditTable(ctx, s.bqClient, s.run, config.PipelineKiotViet, s.summary.End(tableName, err))
+	return err
+}
+
+// streamDocuments pages through the modified documents like the transfers, from the newest to the oldest
+func (s *KiotVietStreaming) streamDocuments(ctx context.Context, tableName string, list listDocuments, until time.Time, incremental bool) error {
+	table, _ := findKiotVietTable(tableName)
+	if err := s.ensureTables(ctx, table); err != nil {
+		return err
+	}
+
+	offset := 0
+	from := s.lastModifiedFrom(ctx, tableName, until, incremental)
+	for true {
+		var documents []document
+		for true {
+			page, err := list(ctx, from, ListDocumentsLimit, offset)
+			if err != nil {
+				return err
+			}
+			offset += ListDocumentsLimit
+			for _, d := range page {
+				if d.date != nil && d.date.ToTime().After(until) {
+					continue
+				}
+				documents = append(documents, d)
+			}
+			if len(page) == 0 || len(documents) >= ListDocumentsBatchSize {
+				break
+			}
+		}
+
+		if len(documents) == 0 {
+			log.WithFields(log.Fields{
+				"tableName":        tableName,
+				"lastModifiedFrom": from,
+			}).Infoln("done pushing the modified documents into presync dataset")
+			break
+		}
+
+		logEntry := log.WithFields(log.Fields{
+			"tableName": tableName,
+			"batchSize": ListDocumentsBatchSize,
+			"offset":    offset,
+		})
+		if err := s.streamDocumentsPage(ctx, tableName, documents); err != nil {
+			logEntry.WithField("error", err).Errorln("error streaming documents page")
+			break
+		}
+		logEntry.Infoln("done streaming documents page")
+	}
+
+	return s.mergeTables(ctx, table)
+}
+
+// streamDocumentsPage fetches the lines of the documents in parallel, like StreamTransfersPage, then writes them
+func (s *KiotVietStreaming) streamDocumentsPage(ctx context.Context, tableName string, documents []document) error {
+	var wg sync.WaitGroup
+	var lock = sync.Mutex{}
+	var firstErr error
+
+	logEntry := log.WithFields(log.Fields{
+		"function":  "streamDocumentsPage",
+		"tableName": tableName,
+	})
+	defer helpers.Elapsed(logEntry)()
+
+	maxGettingDetailRoutines := 50
+	guard := make(chan struct{}, maxGettingDetailRoutines)
+	documentIDToRows := make(map[int64][]data.Row)
+
+	for _, d := range documents {
+		guard <- struct{}{}
+		wg.Add(1)
+		go func(d document) {
+			defer func() {
+				<-guard
+				wg.Done()
+			}()
+			rows, err := d.rows(ctx)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				log.WithFields(log.Fields{
+					"tableName":  tableName,
+					"documentID": d.id,
+					"error":      err,
+				}).Errorln("error getting document detail")
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			documentIDToRows[d.id] = rows
+		}(d)
+	}
+
+	wg.Wait()
+	// a document without its lines would be merged incomplete, the page is written only once all details are fetched.
+	// The page counts as a failed batch so the watermark doesn't move past its documents
+	if firstErr != nil {
+		s.summary.AddBatch(tableName, 0, nil)
+		return firstErr
+	}
+
+	var rows []data.Row
+	for _, d := range documents {
+		rows = append(rows, documentIDToRows[d.id]...)
+	}
+	return s.writeRows(ctx, tableName, rows)
+}
+
+func orderToRows(order kiotviet.Order) []data.Row {
+	header := make(map[string]interface{})
+	header["id"] = order.ID
+	header["code"] = order.Code
+	if order.PurchaseDate != nil {
+		header["purchase_date"] = order.PurchaseDate.ToTime()
+	}
+	header["branch_id"] = order.BranchID
+	header["branch_name"] = order.BranchName
+	header["sold_by_id"] = order.SoldByID
+	header["sold_by_name"] = order.SoldByName
+	if order.CustomerID != nil {
+		header["customer_id"] = *order.CustomerID
+	}
+	header["customer_code"] = order.CustomerCode
+	header["customer_name"] = order.CustomerName
+	header["total"] = order.Total
+	header["total_payment"] = order.TotalPayment
+	header["status"] = order.Status
+	header["status_value"] = order.StatusValue
+	header["description"] = order.Description
+	header["retailer_id"] = order.RetailerID
+	if order.CreatedDate != nil {
+		header["created_date"] = order.CreatedDate.ToTime()
+	}
+	if order.ModifiedDate != nil {
+		header["modified_date"] = order.ModifiedDate.ToTime()
+	}
+
+	// an order without lines is kept as a header row with a null _sub_id
+	if len(order.OrderDetails) == 0 {
+		header["_sub_id"] = nil
+		return []data.Row{{Values: header}}
+	}
+
+	var rows []data.Row
+	for i, detail := range order.OrderDetails {
+		row := make(map[string]interface{}, len(header)+8)
+		for k, v := range header {
+			row[k] = v
+		}
+		// Order line ID is a pair (id, _sub_id)
+		row["_sub_id"] = i + 1
+
+		// detail
+		row["product_id"] = detail.ProductID
+		row["product_code"] = detail.ProductCode
+		row["product_name"] = detail.ProductName
+		row["quantity"] = detail.Quantity
+		row["price"] = detail.Price
+		row["discount"] = detail.Discount
+		row["discount_ratio"] = detail.DiscountRatio
+		row["note"] = detail.Note
+		rows = append(rows, data.Row{Values: row})
+	}
+	return rows
+}
+
+func returnToRows(r kiotviet.Return) []data.Row {
+	header := make(map[string]interface{})
+	header["id"] = r.ID
+	header["code"] = r.Code
+	if r.InvoiceID != nil {
+		header["invoice_id"] = *r.InvoiceID
+	}
+	if r.ReturnDate != nil {
+		header["return_date"] = r.ReturnDate.ToTime()
+	}
+	header["branch_id"] = r.BranchID
+	header["branch_name"] = r.BranchName
+	header["received_by_id"] = r.ReceivedByID
+	header["sold_by_name"] = r.SoldByName
+	if r.CustomerID != nil {
+		header["customer_id"] = *r.CustomerID
+	}
+	header["customer_code"] = r.CustomerCode
+	header["customer_name"] = r.CustomerName
+	header["return_total"] = r.ReturnTotal
+	header["return_discount"] = r.ReturnDiscount
+	header["return_fee"] = r.ReturnFee
+	header["total_payment"] = r.TotalPayment
+	header["status"] = r.Status
+	header["status_value"] = r.StatusValue
+	header["retailer_id"] = r.RetailerID
+	if r.CreatedDate != nil {
+		header["created_date"] = r.CreatedDate.ToTime()
+	}
+	if r.ModifiedDate != nil {
+		header["modified_date"] = r.ModifiedDate.ToTime()
+	}
+
+	// a return without lines is kept as a header row with a null _sub_id
+	if len(r.ReturnDetails) == 0 {
+		header["_sub_id"] = nil
+		return []data.Row{{Values: header}}
+	}
+
+	var rows []data.Row
+	for i, detail := range r.ReturnDetails {
+		row := make(map[string]interface{}, len(header)+8)
+		for k, v := range header {
+			row[k] = v
+		}
+		// Return line ID is a pair (id, _sub_id)
+		row["_sub_id"] = i + 1
+
+		// detail
+		row["product_id"] = detail.ProductID
+		row["product_code"] = detail.ProductCode
+		row["product_name"] = detail.ProductName
+		row["quantity"] = detail.Quantity
+		row["price"] = detail.Price
+		row["sub_total"] = detail.SubTotal
+		row["note"] = detail.Note
+		rows = append(rows, data.Row{Values: row})
+	}
+	return rows
+}
+
+func purchaseOrderToRows(purchaseOrder kiotviet.PurchaseOrder) []data.Row {
+	header := make(map[string]interface{})
+	header["id"] = purchaseOrder.ID
+	header["code"] = purchaseOrder.Code
+	if purchaseOrder.PurchaseDate != nil {
+		header["purchase_date"] = purchaseOrder.PurchaseDate.ToTime()
+	}
+	header["branch_id"] = purchaseOrder.BranchID
+	header["branch_name"] = purchaseOrder.BranchName
+	if purchaseOrder.SupplierID != nil {
+		header["supplier_id"] = *purchaseOrder.SupplierID
+	}
+	header["supplier_code"] = purchaseOrder.SupplierCode
+	header["supplier_name"] = purchaseOrder.SupplierName
+	header["purchase_by_id"] = purchaseOrder.PurchaseByID
+	header["purchase_name"] = purchaseOrder.PurchaseName
+	header["total"] = purchaseOrder.Total
+	header["total_payment"] = purchaseOrder.TotalPayment
+	header["status"] = purchaseOrder.Status
+	header["description"] = purchaseOrder.Description
+	header["retailer_id"] = purchaseOrder.RetailerID
+	if purchaseOrder.CreatedDate != nil {
+		header["created_date"] = purchaseOrder.CreatedDate.ToTime()
+	}
+	if purchaseOrder.ModifiedDate != nil {
+		header["modified_date"] = purchaseOrder.ModifiedDate.ToTime()
+	}
+
+	// a purchase order without lines is kept as a header row with a null _sub_id
+	if len(purchaseOrder.PurchaseOrderDetails) == 0 {
+		header["_sub_id"] = nil
+		return []data.Row{{Values: header}}
+	}
+
+	var rows []data.Row
+	for i, detail := range purchaseOrder.PurchaseOrderDetails {
+		row := make(map[string]interface{}, len(header)+8)
+		for k, v := range header {
+			row[k] = v
+		}
+		// Purchase order line ID is a pair (id, _sub_id)
+		row["_sub_id"] = i + 1
+
+		// detail
+		row["product_id"] = detail.ProductID
+		row["product_code"] = detail.ProductCode
+		row["product_name"] = detail.ProductName
+		row["quantity"] = detail.Quantity
+		row["price"] = detail.Price
+		row["discount"] = detail.Discount
+		row["serial_numbers"] = detail.SerialNumbers
+		rows = append(rows, data.Row{Values: row})
+	}
+	return rows
+}
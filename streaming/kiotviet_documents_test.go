@@ -0,0 +1,74 @@
+package streaming
+
+import (
+	"db-sync/clients/kiotviet"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderToRows(t *testing.T) {
+	assert := assert.New(t)
+	customerID := int64(5)
+	order := kiotviet.Order{
+		ID:         21,
+		Code:       "DH000021",
+		CustomerID: &customerID,
+		OrderDetails: []kiotviet.OrderDetail{
+			{ProductID: 8, Quantity: 2},
+			{ProductID: 9, Quantity: 1},
+		},
+	}
+
+	rows := orderToRows(order)
+	assert.Len(rows, 2)
+	assert.Equal(int64(21), rows[1].Values["id"])
+	assert.Equal(2, rows[1].Values["_sub_id"])
+	assert.Equal(int64(5), rows[1].Values["customer_id"])
+	assert.Equal(int64(9), rows[1].Values["product_id"])
+	// the header values are copied in every line
+	assert.Equal("DH000021", rows[0].Values["code"])
+
+	rows = orderToRows(kiotviet.Order{ID: 22, CustomerID: &customerID})
+	assert.Len(rows, 1)
+	assert.Nil(rows[0].Values["_sub_id"])
+	assert.Equal(int64(5), rows[0].Values["customer_id"])
+}
+
+func TestReturnToRows(t *testing.T) {
+	assert := assert.New(t)
+	r := kiotviet.Return{
+		ID:            4,
+		ReturnDetails: []kiotviet.ReturnDetail{{ProductID: 8, Quantity: 1}},
+	}
+
+	rows := returnToRows(r)
+	assert.Len(rows, 1)
+	assert.Equal(1, rows[0].Values["_sub_id"])
+	assert.NotContains(rows[0].Values, "invoice_id")
+
+	rows = returnToRows(kiotviet.Return{ID: 4})
+	assert.Len(rows, 1)
+	assert.Nil(rows[0].Values["_sub_id"])
+}
+
+func TestPurchaseOrderToRows(t *testing.T) {
+	assert := assert.New(t)
+	rows := purchaseOrderToRows(kiotviet.PurchaseOrder{ID: 3, Code: "PN000003"})
+	assert.Len(rows, 1)
+	assert.Equal(int64(3), rows[0].Values["id"])
+	assert.Equal("PN000003", rows[0].Values["code"])
+	assert.Nil(rows[0].Values["_sub_id"])
+	assert.Contains(rows[0].Values, "_sub_id")
+	assert.NotContains(rows[0].Values, "product_id")
+
+	supplierID := int64(2)
+	rows = purchaseOrderToRows(kiotviet.PurchaseOrder{
+		ID:                   3,
+		SupplierID:           &supplierID,
+		PurchaseOrderDetails: []kiotviet.PurchaseOrderDetail{{ProductID: 8, Quantity: 10, Price: 50000}},
+	})
+	assert.Len(rows, 1)
+	assert.Equal(int64(2), rows[0].Values["supplier_id"])
+	assert.Equal(float64(50000), rows[0].Values["price"])
+}
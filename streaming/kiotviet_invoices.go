@@ -0,0 +1,168 @@
+package streaming
+
+import (
+	"context"
+	"db-sync/clients/kiotviet"
+	"db-sync/config"
+	"db-sync/data"
+	"encoding/json"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	KiotvietInvoiceTable       = "kiotviet_invoices"
+	KiotvietInvoiceDetailTable = "kiotviet_invoice_details"
+)
+
+const ListInvoicesLimit = 100
+
+var invoicesKeyColumns = []string{"id"}
+
+// invoiceDetailsKeyColumns identify an invoice line, like a transfer detail
+var invoiceDetailsKeyColumns = []string{"id", "_sub_id"}
+
+// StreamInvoices streams the invoices modified since the last succeeded run with their lines, then merges them
+// and audits the run
+func (s *KiotVietStreaming) StreamInvoices(ctx context.Context) error {
+	return s.streamInvoices(ctx, time.Now(), true)
+}
+
+// StreamInvoicesUntil streams the invoices modified in the initial lookback before until and purchased before until
+func (s *KiotVietStreaming) StreamInvoicesUntil(ctx context.Context, until time.Time) error {
+	return s.streamInvoices(ctx, until, false)
+}
+
+func (s *KiotVietStreaming) streamInvoices(ctx context.Context, until time.Time, incremental bool) error {
+	s.summary.Start(KiotvietInvoiceTable)
+	s.summary.Start(KiotvietInvoiceDetailTable)
+	err := s.streamInvoicesUntil(ctx, until, incremental)
+	auditTable(ctx, s.bqClient, s.run, config.PipelineKiotViet, s.summary.End(KiotvietInvoiceTable, err))
+	auditTable(ctx, s.bqClient, s.run, config.PipelineKiotViet, s.summary.End(KiotvietInvoiceDetailTable, err))
+	return err
+}
+
+func (s *KiotVietStreaming) streamInvoicesUntil(ctx context.Context, until time.Time, incremental bool) error {
+	invoices, _ := findKiotVietTable(KiotvietInvoiceTable)
+	details, _ := findKiotVietTable(KiotvietInvoiceDetailTable)
+	if err := s.ensureTables(ctx, invoices, details); err != nil {
+		return err
+	}
+
+	filter := kiotviet.InvoiceFilter{
+		LastModifiedFrom: s.lastModifiedFrom(ctx, KiotvietInvoiceTable, until, incremental),
+	}
+	// the lines are listed with their invoice, they share its watermark
+	if incremental {
+		s.summary.SetWatermark(KiotvietInvoiceDetailTable, until)
+	} else {
+		// KiotViet filters on the local time of the retailer
+		filter.ToPurchaseDate = until.In(s.run.Dest.Timezone)
+	}
+	offset := 0
+	for true {
+		page, err := s.kiotVietClient.ListInvoices(ctx, filter, ListInvoicesLimit, offset)
+		if err != nil {
+			return err
+		}
+		if len(page.Invoices) == 0 {
+			break
+		}
+		offset += len(page.Invoices)
+
+		invoiceRows, detailRows, err := invoicesToRows(page.Invoices)
+		if err != nil {
+			return err
+		}
+		if err := s.writeRows(ctx, KiotvietInvoiceTable, invoiceRows); err != nil {
+			return err
+		}
+		if err := s.writeRows(ctx, KiotvietInvoiceDetailTable, detailRows); err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"offset": offset,
+			"total":  page.Total,
+		}).Infoln("done streaming invoices page")
+		if int64(offset) >= page.Total {
+			break
+		}
+	}
+
+	return s.mergeTables(ctx, invoices, details)
+}
+
+// invoicesToRows converts invoices into the rows of kiotviet_invoices and their lines into the rows of
+// kiotviet_invoice_details, numbered from 1 in the order of the invoice
+func invoicesToRows(invoices []kiotviet.Invoice) ([]data.Row, []data.Row, error) {
+	var invoiceRows []data.Row
+	var detailRows []data.Row
+	for _, i := range invoices {
+		invoice := make(map[string]interface{})
+		invoice["id"] = i.ID
+		invoice["uuid"] = i.UUID
+		invoice["code"] = i.Code
+		if i.PurchaseDate != nil {
+			invoice["purchase_date"] = i.PurchaseDate.ToTime()
+		}
+		invoice["branch_id"] = i.BranchID
+		invoice["branch_name"] = i.BranchName
+		invoice["sold_by_id"] = i.SoldByID
+		invoice["sold_by_name"] = i.SoldByName
+		if i.CustomerID != nil {
+			invoice["customer_id"] = *i.CustomerID
+		}
+		invoice["customer_code"] = i.CustomerCode
+		invoice["customer_name"] = i.CustomerName
+		invoice["order_code"] = i.OrderCode
+		invoice["total"] = i.Total
+		invoice["total_payment"] = i.TotalPayment
+		invoice["discount"] = i.Discount
+		invoice["status"] = i.Status
+		invoice["status_value"] = i.StatusValue
+		invoice["description"] = i.Description
+		invoice["using_cod"] = i.UsingCod
+		invoice["retailer_id"] = i.RetailerID
+		if i.CreatedDate != nil {
+			invoice["created_date"] = i.CreatedDate.ToTime()
+		}
+		if i.ModifiedDate != nil {
+			invoice["modified_date"] = i.ModifiedDate.ToTime()
+		}
+		if len(i.Payments) > 0 {
+			payments, err := json.Marshal(i.Payments)
+			if err != nil {
+				return nil, nil, err
+			}
+			invoice["payments"] = string(payments)
+		}
+		invoiceRows = append(invoiceRows, data.Row{Values: invoice})
+
+		for n, d := range i.InvoiceDetails {
+			detail := make(map[string]interface{})
+			// Invoice line ID is a pair (id, _sub_id)
+			detail["id"] = i.ID
+			detail["_sub_id"] = n + 1
+			detail["code"] = i.Code
+			if i.PurchaseDate != nil {
+				detail["purchase_date"] = i.PurchaseDate.ToTime()
+			}
+			detail["branch_id"] = i.BranchID
+			detail["product_id"] = d.ProductID
+			detail["product_code"] = d.ProductCode
+			detail["product_name"] = d.ProductName
+			detail["quantity"] = d.Quantity
+			detail["price"] = d.Price
+			detail["discount"] = d.Discount
+			detail["discount_ratio"] = d.DiscountRatio
+			detail["sub_total"] = d.SubTotal
+			detail["note"] = d.Note
+			detail["serial_numbers"] = d.SerialNumbers
+			detailRows = append(detailRows, data.Row{Values: detail})
+		}
+	}
+
+	return invoiceRows, detailRows, nil
+}
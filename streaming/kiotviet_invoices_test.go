@@ -0,0 +1,49 @@
+package streaming
+
+import (
+	"db-sync/clients/kiotviet"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvoicesToRows(t *testing.T) {
+	assert := assert.New(t)
+	invoices := []kiotviet.Invoice{
+		{
+			ID:   12,
+			Code: "HD000012",
+			InvoiceDetails: []kiotviet.InvoiceDetail{
+				{ProductID: 8, Quantity: 2, Price: 60000},
+				{ProductID: 9, Quantity: 1, Price: 15000},
+			},
+			Payments: []kiotviet.InvoicePayment{
+				{ID: 3, Method: "Cash", Amount: 135000},
+			},
+		},
+		{ID: 13, Code: "HD000013"},
+	}
+
+	invoiceRows, detailRows, err := invoicesToRows(invoices)
+	assert.Nil(err)
+	assert.Len(invoiceRows, 2)
+	assert.Contains(invoiceRows[0].Values["payments"], `"method":"Cash"`)
+	assert.NotContains(invoiceRows[1].Values, "customer_id")
+	assert.NotContains(invoiceRows[1].Values, "payments")
+
+	assert.Len(detailRows, 2)
+	assert.Equal(int64(12), detailRows[1].Values["id"])
+	assert.Equal(2, detailRows[1].Values["_sub_id"])
+	assert.Equal(int64(9), detailRows[1].Values["product_id"])
+	assert.Equal("HD000012", detailRows[1].Values["code"])
+}
+
+func TestFindKiotVietTable(t *testing.T) {
+	assert := assert.New(t)
+	table, ok := findKiotVietTable(KiotvietInvoiceDetailTable)
+	assert.True(ok)
+	assert.Equal([]string{"id", "_sub_id"}, table.keyColumns)
+
+	_, ok = findKiotVietTable("kiotviet_unknown")
+	assert.False(ok)
+}
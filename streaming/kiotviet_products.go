@@ -0,0 +1,157 @@
+package streaming
+
+import (
+	"context"
+	"db-sync/clients/kiotviet"
+	"db-sync/config"
+	"db-sync/data"
+	"encoding/json"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	KiotvietProductTable   = "kiotviet_products"
+	KiotvietInventoryTable = "kiotviet_inventories"
+)
+
+const ListProductsLimit = 100
+
+var productsKeyColumns = []string{"id"}
+
+// inventoriesKeyColumns identify the inventory of a product in a branch
+var inventoriesKeyColumns = []string{"product_id", "branch_id"}
+
+// StreamProducts syncs the product catalog with its prices and the on-hand inventory of every branch.
+// Both tables are read from the products endpoint, then merged and audited
+func (s *KiotVietStreaming) StreamProducts(ctx context.Context) error {
+	s.summary.Start(KiotvietProductTable)
+	s.summary.Start(KiotvietInventoryTable)
+	err := s.streamProducts(ctx)
+	auditTable(ctx, s.bqClient, s.run, config.PipelineKiotViet, s.summary.End(KiotvietProductTable, err))
+	auditTable(ctx, s.bqClient, s.run, config.PipelineKiotViet, s.summary.End(KiotvietInventoryTable, err))
+	return err
+}
+
+func (s *KiotVietStreaming) streamProducts(ctx context.Context) error {
+	products, _ := findKiotVietTable(KiotvietProductTable)
+	inventories, _ := findKiotVietTable(KiotvietInventoryTable)
+	if err := s.ensureTables(ctx, products, inventories); err != nil {
+		return err
+	}
+
+	offset := 0
+	for true {
+		page, err := s.kiotVietClient.ListProducts(ctx, ListProductsLimit, offset, true, true)
+		if err != nil {
+			return err
+		}
+		if len(page.Products) == 0 {
+			break
+		}
+		offset += len(page.Products)
+
+		productRows, inventoryRows, err := productsToRows(page.Products)
+		if err != nil {
+			return err
+		}
+		if err := s.writeRows(ctx, KiotvietProductTable, productRows); err != nil {
+			return err
+		}
+		if err := s.writeRows(ctx, KiotvietInventoryTable, inventoryRows); err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"offset": offset,
+			"total":  page.Total,
+		}).Infoln("done streaming products page")
+		if int64(offset) >= page.Total {
+			break
+		}
+	}
+
+	return s.mergeTables(ctx, products, inventories)
+}
+
+// writeRows writes rows into the presync table and records the batch in the summary
+func (s *KiotVietStreaming) writeRows(ctx context.Context, tableName string, rows []data.Row) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	result, err := s.bqClient.Write(ctx, s.run, tableName, &data.Rows{Rows: rows})
+	if err != nil {
+		s.summary.AddBatch(tableName, len(rows), nil)
+		return err
+	}
+	s.summary.AddBatch(tableName, len(rows), result)
+	return nil
+}
+
+// productsToRows converts products into the rows of kiotviet_products and their inventories into the rows of kiotviet_inventories
+func productsToRows(products []kiotviet.Product) ([]data.Row, []data.Row, error) {
+	var productRows []data.Row
+	var inventoryRows []data.Row
+	for _, p := range products {
+		product := make(map[string]interface{})
+		product["id"] = p.ID
+		product["code"] = p.Code
+		product["bar_code"] = p.BarCode
+		product["name"] = p.Name
+		product["full_name"] = p.FullName
+		product["category_id"] = p.CategoryID
+		product["category_name"] = p.CategoryName
+		product["allows_sale"] = p.AllowsSale
+		product["type"] = p.Type
+		product["has_variants"] = p.HasVariants
+		product["base_price"] = p.BasePrice
+		product["weight"] = p.Weight
+		product["unit"] = p.Unit
+		if p.MasterProductID != nil {
+			product["master_product_id"] = *p.MasterProductID
+		}
+		if p.MasterUnitID != nil {
+			product["master_unit_id"] = *p.MasterUnitID
+		}
+		product["conversion_value"] = p.ConversionValue
+		product["description"] = p.Description
+		product["is_active"] = p.IsActive
+		product["retailer_id"] = p.RetailerID
+		if p.CreatedDate != nil {
+			product["created_date"] = p.CreatedDate.ToTime()
+		}
+		if p.ModifiedDate != nil {
+			product["modified_date"] = p.ModifiedDate.ToTime()
+		}
+		if len(p.PriceBooks) > 0 {
+			priceBooks, err := json.Marshal(p.PriceBooks)
+			if err != nil {
+				return nil, nil, err
+			}
+			product["price_books"] = string(priceBooks)
+		}
+		productRows = append(productRows, data.Row{Values: product})
+
+		for _, i := range p.Inventories {
+			inventoryRows = append(inventoryRows, inventoryToRow(p.ID, i))
+		}
+	}
+
+	return productRows, inventoryRows, nil
+}
+
+func inventoryToRow(productID int64, i kiotviet.ProductInventory) data.Row {
+	inventory := make(map[string]interface{})
+	inventory["product_id"] = productID
+	inventory["branch_id"] = i.BranchID
+	inventory["product_code"] = i.ProductCode
+	inventory["branch_name"] = i.BranchName
+	inventory["cost"] = i.Cost
+	inventory["on_hand"] = i.OnHand
+	inventory["reserved"] = i.Reserved
+	inventory["min_quantity"] = i.MinQuantity
+	inventory["max_quantity"] = i.MaxQuantity
+	inventory["on_order"] = i.OnOrder
+	return data.Row{Values: inventory}
+}
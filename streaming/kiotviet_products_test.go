@@ -0,0 +1,40 @@
+package streaming
+
+import (
+	"db-sync/clients/kiotviet"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProductsToRows(t *testing.T) {
+	assert := assert.New(t)
+	masterID := int64(7)
+	products := []kiotviet.Product{
+		{
+			ID:              8,
+			Code:            "SP000008",
+			MasterProductID: &masterID,
+			Inventories: []kiotviet.ProductInventory{
+				{ProductID: 8, BranchID: 1, OnHand: 3},
+				{ProductID: 8, BranchID: 2, OnHand: 0},
+			},
+			PriceBooks: []kiotviet.ProductPriceBook{
+				{PriceBookID: 4, ProductID: 8, Price: 120000},
+			},
+		},
+		{ID: 9, Code: "SP000009"},
+	}
+
+	productRows, inventoryRows, err := productsToRows(products)
+	assert.Nil(err)
+	assert.Len(productRows, 2)
+	assert.Equal(int64(7), productRows[0].Values["master_product_id"])
+	assert.Contains(productRows[0].Values["price_books"], `"price":120000`)
+	assert.NotContains(productRows[1].Values, "master_product_id")
+	assert.NotContains(productRows[1].Values, "price_books")
+
+	assert.Len(inventoryRows, 2)
+	assert.Equal(int64(8), inventoryRows[1].Values["product_id"])
+	assert.Equal(int64(2), inventoryRows[1].Values["branch_id"])
+}
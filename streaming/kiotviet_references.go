@@ -0,0 +1,306 @@
+package streaming
+
+import (
+	"context"
+	"db-sync/clients/kiotviet"
+	"db-sync/config"
+	"db-sync/data"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	KiotvietBranchTable   = "kiotviet_branches"
+	KiotvietUserTable     = "kiotviet_users"
+	KiotvietCategoryTable = "kiotviet_categories"
+	KiotvietSupplierTable = "kiotviet_suppliers"
+	KiotvietCustomerTable = "kiotviet_customers"
+)
+
+const ListReferencesLimit = 100
+
+var referencesKeyColumns = []string{"id"}
+
+var categoriesKeyColumns = []string{"category_id"}
+
+// referenceTables are the lookup tables of the documents, synced in full on every run
+var referenceTables = []string{
+	KiotvietBranchTable,
+	KiotvietUserTable,
+	KiotvietCategoryTable,
+	KiotvietSupplierTable,
+	KiotvietCustomerTable,
+}
+
+// listReferences returns the rows of a page of reference data and the total number of rows
+type listReferences func(ctx context.Context, limit int, offset int) ([]data.Row, int64, error)
+
+// StreamReferenceData syncs all the reference tables, a failing table doesn't stop the others
+func (s *KiotVietStreaming) StreamReferenceData(ctx context.Context) error {
+	var failed []string
+	for _, tableName := range referenceTables {
+		if err := s.StreamReferenceTable(ctx, tableName); err != nil {
+			log.WithFields(log.Fields{
+				"tableName": tableName,
+				"error":     err,
+			}).Errorln("error streaming reference table")
+			failed = append(failed, tableName)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("error streaming %s", strings.Join(failed, ","))
+	}
+	return nil
+}
+
+// StreamReferenceTable lists all the rows of a reference table, then merges and audits it
+func (s *KiotVietStreaming) StreamReferenceTable(ctx context.Context, tableName string) error {
+	list, err := s.referenceLister(tableName)
+	if err != nil {
+		return err
+	}
+
+	s.summary.Start(tableName)
+	err = s.streamReferences(ctx, tableName, list)
+	auditTable(ctx, s.bqClient, s.run, config.PipelineKiotViet, s.summary.End(tableName, err))
+	return err
+}
+
+func (s *KiotVietStreaming) streamReferences(ctx context.Context, tableName string, list listReferences) error {
+	table, _ := findKiotVietTable(tableName)
+	if err := s.ensureTables(ctx, table); err != nil {
+		return err
+	}
+
+	offset := 0
+	for true {
+		rows, total, err := list(ctx, ListReferencesLimit, offset)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		offset += len(rows)
+
+		if err := s.writeRows(ctx, tableName, rows); err != nil {
+			return err
+		}
+		if int64(offset) >= total {
+			break
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"tableName": tableName,
+		"rows":      offset,
+	}).Infoln("done streaming reference table")
+	return s.mergeTables(ctx, table)
+}
+
+func (s *KiotVietStreaming) referenceLister(tableName string) (listReferences, error) {
+	switch tableName {
+	case KiotvietBranchTable:
+		return func(ctx context.Context, limit int, offset int) ([]data.Row, int64, error) {
+			page, err := s.kiotVietClient.ListBranches(ctx, limit, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			return branchesToRows(page.Branches), page.Total, nil
+		}, nil
+	case KiotvietUserTable:
+		return func(ctx context.Context, limit int, offset int) ([]data.Row, int64, error) {
+			page, err := s.kiotVietClient.ListUsers(ctx, limit, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			s.addUserNames(page.Users)
+			return usersToRows(page.Users), page.Total, nil
+		}, nil
+	case KiotvietCategoryTable:
+		return func(ctx context.Context, limit int, offset int) ([]data.Row, int64, error) {
+			page, err := s.kiotVietClient.ListCategories(ctx, limit, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			return categoriesToRows(page.Categories), page.Total, nil
+		}, nil
+	case KiotvietSupplierTable:
+		return func(ctx context.Context, limit int, offset int) ([]data.Row, int64, error) {
+			page, err := s.kiotVietClient.ListSuppliers(ctx, limit, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			return suppliersToRows(page.Suppliers), page.Total, nil
+		}, nil
+	case KiotvietCustomerTable:
+		return func(ctx context.Context, limit int, offset int) ([]data.Row, int64, error) {
+			page, err := s.kiotVietClient.ListCustomers(ctx, limit, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			return customersToRows(page.Customers), page.Total, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("table %s is not a KiotViet reference table", tableName)
+}
+
+// loadUserNames lists the users once per run to name the creators of the transfers. The names are already known
+// when the users were synced first, a failure only leaves the names empty
+func (s *KiotVietStreaming) loadUserNames(ctx context.Context) {
+	if s.userNames != nil {
+		return
+	}
+
+	offset := 0
+	for true {
+		page, err := s.kiotVietClient.ListUsers(ctx, ListReferencesLimit, offset)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Warnln("error listing users, created_user_name won't be filled")
+			return
+		}
+		if len(page.Users) == 0 {
+			break
+		}
+		s.addUserNames(page.Users)
+		offset += len(page.Users)
+		if int64(offset) >= page.Total {
+			break
+		}
+	}
+}
+
+func (s *KiotVietStreaming) addUserNames(users []kiotviet.User) {
+	if s.userNames == nil {
+		s.userNames = make(map[int64]string)
+	}
+	for _, u := range users {
+		name := u.GivenName
+		if name == "" {
+			name = u.UserName
+		}
+		s.userNames[u.ID] = name
+	}
+}
+
+func branchesToRows(branches []kiotviet.Branch) []data.Row {
+	var rows []data.Row
+	for _, b := range branches {
+		row := make(map[string]interface{})
+		row["id"] = b.ID
+		row["branch_name"] = b.BranchName
+		row["branch_code"] = b.BranchCode
+		row["contact_number"] = b.ContactNumber
+		row["address"] = b.Address
+		row["location_name"] = b.LocationName
+		row["ward_name"] = b.WardName
+		row["email"] = b.Email
+		setReferenceDates(row, b.RetailerID, b.CreatedDate, b.ModifiedDate)
+		rows = append(rows, data.Row{Values: row})
+	}
+	return rows
+}
+
+func usersToRows(users []kiotviet.User) []data.Row {
+	var rows []data.Row
+	for _, u := range users {
+		row := make(map[string]interface{})
+		row["id"] = u.ID
+		row["user_name"] = u.UserName
+		row["given_name"] = u.GivenName
+		row["description"] = u.Description
+		setReferenceDates(row, u.RetailerID, u.CreatedDate, u.ModifiedDate)
+		rows = append(rows, data.Row{Values: row})
+	}
+	return rows
+}
+
+func categoriesToRows(categories []kiotviet.Category) []data.Row {
+	var rows []data.Row
+	for _, c := range categories {
+		row := make(map[string]interface{})
+		row["category_id"] = c.CategoryID
+		row["category_name"] = c.CategoryName
+		if c.ParentID != nil {
+			row["parent_id"] = *c.ParentID
+		}
+		row["has_child"] = c.HasChild
+		setReferenceDates(row, c.RetailerID, c.CreatedDate, c.ModifiedDate)
+		rows = append(rows, data.Row{Values: row})
+	}
+	return rows
+}
+
+func suppliersToRows(suppliers []kiotviet.Supplier) []data.Row {
+	var rows []data.Row
+	for _, s := range suppliers {
+		row := make(map[string]interface{})
+		row["id"] = s.ID
+		row["code"] = s.Code
+		row["name"] = s.Name
+		row["contact_number"] = s.ContactNumber
+		row["email"] = s.Email
+		row["address"] = s.Address
+		row["location_name"] = s.LocationName
+		row["ward_name"] = s.WardName
+		row["organization"] = s.Organization
+		row["tax_code"] = s.TaxCode
+		row["comments"] = s.Comments
+		row["debt"] = s.Debt
+		row["total_invoiced"] = s.TotalInvoiced
+		row["is_active"] = s.IsActive
+		if s.BranchID != nil {
+			row["branch_id"] = *s.BranchID
+		}
+		setReferenceDates(row, s.RetailerID, s.CreatedDate, s.ModifiedDate)
+		rows = append(rows, data.Row{Values: row})
+	}
+	return rows
+}
+
+func customersToRows(customers []kiotviet.Customer) []data.Row {
+	var rows []data.Row
+	for _, c := range customers {
+		row := make(map[string]interface{})
+		row["id"] = c.ID
+		row["code"] = c.Code
+		row["name"] = c.Name
+		if c.Gender != nil {
+			row["gender"] = *c.Gender
+		}
+		row["contact_number"] = c.ContactNumber
+		row["email"] = c.Email
+		row["address"] = c.Address
+		row["location_name"] = c.LocationName
+		row["ward_name"] = c.WardName
+		row["organization"] = c.Organization
+		row["tax_code"] = c.TaxCode
+		row["comments"] = c.Comments
+		row["debt"] = c.Debt
+		row["total_invoiced"] = c.TotalInvoiced
+		row["total_point"] = c.TotalPoint
+		row["total_revenue"] = c.TotalRevenue
+		row["groups"] = c.Groups
+		if c.BranchID != nil {
+			row["branch_id"] = *c.BranchID
+		}
+		setReferenceDates(row, c.RetailerID, c.CreatedDate, c.ModifiedDate)
+		rows = append(rows, data.Row{Values: row})
+	}
+	return rows
+}
+
+// setReferenceDates sets the columns shared by all the reference tables
+func setReferenceDates(row map[string]interface{}, retailerID int64, createdDate *kiotviet.KiotTime, modifiedDate *kiotviet.KiotTime) {
+	row["retailer_id"] = retailerID
+	if createdDate != nil {
+		row["created_date"] = createdDate.ToTime()
+	}
+	if modifiedDate != nil {
+		row["modified_date"] = modifiedDate.ToTime()
+	}
+}
@@ -0,0 +1,36 @@
+package streaming
+
+import (
+	"db-sync/clients/kiotviet"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCategoriesToRows(t *testing.T) {
+	assert := assert.New(t)
+	parentID := int64(1)
+	rows := categoriesToRows([]kiotviet.Category{
+		{CategoryID: 1, CategoryName: "Phones", HasChild: true},
+		{CategoryID: 2, CategoryName: "Cases", ParentID: &parentID},
+	})
+
+	assert.Len(rows, 2)
+	assert.NotContains(rows[0].Values, "parent_id")
+	assert.Equal(int64(1), rows[1].Values["parent_id"])
+	assert.Equal(int64(2), rows[1].Values["category_id"])
+}
+
+func TestReferenceLister(t *testing.T) {
+	assert := assert.New(t)
+	s := NewKiotVietStreaming(nil, nil, nil)
+	for _, tableName := range referenceTables {
+		_, err := s.referenceLister(tableName)
+		assert.Nil(err)
+		_, ok := findKiotVietTable(tableName)
+		assert.True(ok)
+	}
+
+	_, err := s.referenceLister(KiotvietTransferTable)
+	assert.NotNil(err)
+}
@@ -7,8 +7,6 @@ import (
 	"db-sync/config"
 	"db-sync/data"
 	"db-sync/helpers"
-	"fmt"
-	"strings"
 	"sync"
 	"time"
 
@@ -18,6 +16,14 @@ import (
 type KiotVietStreaming struct {
 	kiotVietClient *kiotviet.Client
 	bqClient       *biqueryclient.Client
+	run            *biqueryclient.Run
+	summary        *RunSummary
+	// initialLookback is how far back the documents are listed without a watermark
+	initialLookback time.Duration
+	// userNames maps the user ids to their names, loaded by loadUserNames
+	userNames map[int64]string
+	// lastWatermark reads the watermark of the last succeeded run of the table, see resumeFrom
+	lastWatermark func(ctx context.Context, tableName string) (time.Time, error)
 }
 
 const (
@@ -29,40 +35,112 @@ const (
 	KiotvietTransferTable = "kiotviet_transfers"
 )
 
-var transfersUpdateColumnNames = []string{"id", "_sub_id", "code", "from_branch_id", "to_branch_id", "status", "transfer_date", "received_date", "retailer_id", "sent_note", "received_note", "product_id", "product_code", "product_name", "sent_quantity", "received_quantity", "sent_price", "received_price", "price", "sent_imei_serials", "received_imei_serials", "created_user_name", "barcode"}
+// transfersKeyColumns identify a transfer detail
+var transfersKeyColumns = []string{"id", "_sub_id"}
 
-func NewKiotVietStreaming(bqClient *biqueryclient.Client, kiotvietClient *kiotviet.Client) *KiotVietStreaming {
-	return &KiotVietStreaming{
-		kiotVietClient: kiotvietClient,
-		bqClient:       bqClient,
+var transfersUpdateColumnNames = columnNames(TransferColumns)
+
+// kiotVietTable is a table synced from KiotViet with the columns identifying its rows
+type kiotVietTable struct {
+	name       string
+	keyColumns []string
+	columns    []data.Column
+}
+
+// kiotVietTables are all the tables synced from KiotViet
+var kiotVietTables = []kiotVietTable{
+	{KiotvietTransferTable, transfersKeyColumns, TransferColumns},
+	{KiotvietProductTable, productsKeyColumns, ProductColumns},
+	{KiotvietInventoryTable, inventoriesKeyColumns, InventoryColumns},
+	{KiotvietInvoiceTable, invoicesKeyColumns, InvoiceColumns},
+	{KiotvietInvoiceDetailTable, invoiceDetailsKeyColumns, InvoiceDetailColumns},
+	{KiotvietOrderTable, documentLinesKeyColumns, OrderColumns},
+	{KiotvietReturnTable, documentLinesKeyColumns, ReturnColumns},
+	{KiotvietPurchaseOrderTable, documentLinesKeyColumns, PurchaseOrderColumns},
+	{KiotvietBranchTable, referencesKeyColumns, BranchColumns},
+	{KiotvietUserTable, referencesKeyColumns, UserColumns},
+	{KiotvietCategoryTable, categoriesKeyColumns, CategoryColumns},
+	{KiotvietSupplierTable, referencesKeyColumns, SupplierColumns},
+	{KiotvietCustomerTable, referencesKeyColumns, CustomerColumns},
+}
+
+func findKiotVietTable(tableName string) (kiotVietTable, bool) {
+	for _, table := range kiotVietTables {
+		if table.name == tableName {
+			return table, true
+		}
+	}
+	return kiotVietTable{}, false
+}
+
+func NewKiotVietStreaming(bqClient *biqueryclient.Client, kiotvietClient *kiotviet.Client, run *biqueryclient.Run) *KiotVietStreaming {
+	s := &KiotVietStreaming{
+		kiotVietClient:  kiotvietClient,
+		bqClient:        bqClient,
+		run:             run,
+		summary:         NewRunSummary(),
+		initialLookback: parseInitialLookback(config.KiotVietInitialLookbackDays),
 	}
+	s.lastWatermark = func(ctx context.Context, tableName string) (time.Time, error) {
+		return s.bqClient.LastWatermark(ctx, s.run.Dest, config.PipelineKiotViet, tableName)
+	}
+	return s
 }
 
+func (s *KiotVietStreaming) Summary() *RunSummary {
+	return s.summary
+}
+
+// StreamTransfers streams the transfers modified since the last succeeded run, then merges them and audits the run
 func (s *KiotVietStreaming) StreamTransfers(ctx context.Context) error {
+	return s.streamTransfers(ctx, time.Now(), true)
+}
+
+// StreamTransfersUntil streams the transfers modified in the initial lookback before until, except the transfers
+// dispatched after until. Backfills use it to rebuild the partition of a past date
+func (s *KiotVietStreaming) StreamTransfersUntil(ctx context.Context, until time.Time) error {
+	return s.streamTransfers(ctx, until, false)
+}
+
+func (s *KiotVietStreaming) streamTransfers(ctx context.Context, until time.Time, incremental bool) error {
+	s.summary.Start(KiotvietTransferTable)
+	err := s.streamTransfersUntil(ctx, until, incremental)
+	auditTable(ctx, s.bqClient, s.run, config.PipelineKiotViet, s.summary.End(KiotvietTransferTable, err))
+	return err
+}
+
+func (s *KiotVietStreaming) streamTransfersUntil(ctx context.Context, until time.Time, incremental bool) error {
+	transfers, _ := findKiotVietTable(KiotvietTransferTable)
+	if err := s.ensureTables(ctx, transfers); err != nil {
+		return err
+	}
+	s.loadUserNames(ctx)
+
 	offset := 0
-	twoMonthAgo := time.Now().Add(-(time.Hour * 24 * 60))
+	from := s.lastModifiedFrom(ctx, KiotvietTransferTable, until, incremental)
 	for true {
 		var transfers []kiotviet.TransferBasicInfo
 		for true {
-			page, err := s.kiotVietClient.ListTransfers(ctx, ListTransfersLimit, offset)
+			page, err := s.kiotVietClient.ListTransfers(ctx, from, ListTransfersLimit, offset)
 			if err != nil {
 				return err
 			}
 			offset += ListTransfersLimit
-			transfers = append(transfers, page.Transfers...)
+			for _, transfer := range page.Transfers {
+				if transfer.TransferDate != nil && transfer.TransferDate.ToTime().After(until) {
+					continue
+				}
+				transfers = append(transfers, transfer)
+			}
 			if page.PageSize == 0 || len(transfers) >= ListTransfersBatchSize {
 				break
 			}
 		}
 
 		if len(transfers) == 0 {
-			break
-		}
-
-		if transfers[0].TransferDate != nil && transfers[0].TransferDate.ToTime().Before(twoMonthAgo) {
 			log.WithFields(log.Fields{
-				"lastTransferID": transfers[0].ID,
-			}).Infoln("done pushing 2 month transfer records into presync dataset")
+				"lastModifiedFrom": from,
+			}).Infoln("done pushing modified transfer records into presync dataset")
 			break
 		}
 
@@ -82,23 +160,73 @@ func (s *KiotVietStreaming) StreamTransfers(ctx context.Context) error {
 		}
 	}
 
-	query, err := s.generateMergeQuery(ctx, KiotvietTransferTable, transfersUpdateColumnNames)
-	if err != nil {
-		return err
+	return s.mergeTransfers(ctx)
+}
+
+func (s *KiotVietStreaming) mergeTransfers(ctx context.Context) error {
+	return s.mergeTable(ctx, KiotvietTransferTable, transfersKeyColumns, transfersUpdateColumnNames)
+}
+
+// StreamTableUntil streams the table as the run would have at until. Tables without history, like the catalog and
+// the reference tables, are streamed as they are now
+func (s *KiotVietStreaming) StreamTableUntil(ctx context.Context, tableName string, until time.Time) error {
+	switch tableName {
+	case KiotvietTransferTable:
+		return s.StreamTransfersUntil(ctx, until)
+	case KiotvietProductTable, KiotvietInventoryTable:
+		return s.StreamProducts(ctx)
+	case KiotvietInvoiceTable, KiotvietInvoiceDetailTable:
+		return s.StreamInvoicesUntil(ctx, until)
+	case KiotvietOrderTable:
+		return s.StreamOrdersUntil(ctx, until)
+	case KiotvietReturnTable:
+		return s.StreamReturnsUntil(ctx, until)
+	case KiotvietPurchaseOrderTable:
+		return s.StreamPurchaseOrdersUntil(ctx, until)
+	}
+	return s.StreamReferenceTable(ctx, tableName)
+}
+
+// ensureTables creates or updates the tables and their latest views
+func (s *KiotVietStreaming) ensureTables(ctx context.Context, tables ...kiotVietTable) error {
+	for _, table := range tables {
+		report, err := s.bqClient.EnsureSyncTimePartitionTable(ctx, s.run.Dest, table.name, table.columns)
+		if report != nil {
+			report.Log()
+		}
+		if err != nil {
+			return err
+		}
+		ensureLatestView(ctx, s.bqClient, s.run.Dest, table.name, table.keyColumns, table.columns)
+	}
+	return nil
+}
+
+// mergeTables merges the tables one after the other and stops at the first failing merge
+func (s *KiotVietStreaming) mergeTables(ctx context.Context, tables ...kiotVietTable) error {
+	for _, table := range tables {
+		if err := s.mergeTable(ctx, table.name, table.keyColumns, columnNames(table.columns)); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	q := s.bqClient.Query(query)
-	q.Location = "US"
-	err = helpers.RunQuery(ctx, q)
+func (s *KiotVietStreaming) mergeTable(ctx context.Context, tableName string, keyColumns []string, updateColumnNames []string) error {
+	stmt := s.mergeStatement(tableName, keyColumns, updateColumnNames)
+	cost, err := s.bqClient.RunMerge(ctx, s.run, stmt)
+	if cost != nil {
+		s.summary.AddMergeCost(tableName, cost)
+	}
 
 	if err != nil {
 		log.WithFields(log.Fields{
-			"tableName": KiotvietTransferTable,
+			"tableName": tableName,
 			"error":     err,
 		}).Errorln("error merging table from presync dataset to web-sync dataset in Biqquery")
-	} else {
+	} else if cost.Executed {
 		log.WithFields(log.Fields{
-			"tableName": KiotvietTransferTable,
+			"tableName": tableName,
 		}).Infoln("done merging table from presync dataset to web-sync dataset in Biqquery")
 	}
 	return err
@@ -109,6 +237,7 @@ func (s *KiotVietStreaming) StreamTransfersPage(ctx context.Context, transfers [
 	var rows []data.Row
 	var wg sync.WaitGroup
 	var lock = sync.RWMutex{}
+	var firstErr error
 
 	logEntry := log.WithFields(log.Fields{
 		"function": function,
@@ -123,77 +252,46 @@ func (s *KiotVietStreaming) StreamTransfersPage(ctx context.Context, transfers [
 		guard <- struct{}{}
 		wg.Add(1)
 		go func(transfer kiotviet.TransferBasicInfo) {
+			defer func() {
+				<-guard
+				wg.Done()
+			}()
 			webTransferResp, err := s.kiotVietClient.GetTransferDetailWeb(ctx, transfer.ID)
+
+			lock.Lock()
+			defer lock.Unlock()
 			if err != nil {
 				log.WithFields(log.Fields{
 					"TransferID": transfer.ID,
 					"error":      err,
 				}).Errorln("error getting web detail")
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
 			}
-
-			lock.Lock()
 			transferIDToTransferDetail[transfer.ID] = webTransferResp.TransferDetail
-			lock.Unlock()
-			<-guard
-			wg.Done()
 		}(t)
 	}
 
 	wg.Wait()
+	// the transfers would be merged without their web details, the page is written only once all details are fetched.
+	// The page counts as a failed batch so the watermark doesn't move past its transfers
+	if firstErr != nil {
+		s.summary.AddBatch(KiotvietTransferTable, 0, nil)
+		return firstErr
+	}
 	for _, t := range transfers {
 		convertedRows := s.basicTransferToRows(t, transferIDToTransferDetail[t.ID])
 		rows = append(rows, convertedRows...)
 	}
 
-	err := s.bqClient.InsertOrUpdate(ctx, config.BqPresyncDataset, KiotvietTransferTable, &data.Rows{Rows: rows})
-	return err
+	return s.writeRows(ctx, KiotvietTransferTable, rows)
 }
 
-func (s *KiotVietStreaming) generateMergeQuery(ctx context.Context, tableName string, updateColumnNames []string) (string, error) {
-	temp := `
-		MERGE {{.tableName}} T
-			USING (SELECT
-			agg.table.*
-			FROM (
-			SELECT
-			id,
-			ARRAY_AGG(STRUCT(table)
-			ORDER BY
-			_created_at DESC)[SAFE_OFFSET(0)] agg
-			FROM
-			{{.presyncTableName}} table
-			WHERE
-			{{.whereClause}}
-			GROUP BY
-			id, _sub_id, _date)) S
-			ON T.id = S.id and T._sub_id = S._sub_id and T._date = S._date
-			WHEN MATCHED THEN
-		UPDATE SET {{.updateClause}}
-			WHEN NOT MATCHED THEN
-		INSERT {{.insertFieldClause}} VALUES {{.insertValueClause}}
-		`
-
-	var updateItems []string
-	for _, c := range updateColumnNames {
-		updateItems = append(updateItems, fmt.Sprintf("%s = S.%s", c, c))
-	}
-
-	insertColumnName := append(updateColumnNames, "_date")
-	insertFieldClause := fmt.Sprintf("(%s)", strings.Join(insertColumnName, ","))
-	insertValueClause := insertFieldClause
-	updateClause := strings.Join(updateItems, ",")
-
-	bqTableName := strings.ToLower(tableName)
-	variables := map[string]interface{}{
-		"tableName":         fmt.Sprintf("`%s.%s`", config.BqWebsyncDataset, bqTableName),
-		"presyncTableName":  fmt.Sprintf("`%s.%s`", config.BqPresyncDataset, bqTableName),
-		"updateClause":      updateClause,
-		"insertFieldClause": insertFieldClause,
-		"insertValueClause": insertValueClause,
-		"whereClause":       `_date = CURRENT_DATE("+7")`,
-	}
-
-	return helpers.MakeTemplateFile(temp, variables)
+// mergeStatement merges the rows of the run with the merge strategy of the table options
+func (s *KiotVietStreaming) mergeStatement(tableName string, keyColumns []string, updateColumnNames []string) biqueryclient.MergeStatement {
+	return s.run.MergeStatement(tableName, keyColumns, updateColumnNames)
 }
 
 func (s *KiotVietStreaming) basicTransferToRows(basicTransfer kiotviet.TransferBasicInfo, webTransferDetails []*kiotviet.WebTransferDetail) []data.Row {
@@ -216,6 +314,12 @@ func (s *KiotVietStreaming) basicTransferToRows(basicTransfer kiotviet.TransferB
 		transfer["retailer_id"] = basicTransfer.RetailerID
 		transfer["sent_note"] = basicTransfer.Description
 		transfer["status"] = basicTransfer.Status
+		if basicTransfer.CreatedByID != nil {
+			transfer["created_by_id"] = *basicTransfer.CreatedByID
+			if name, ok := s.userNames[*basicTransfer.CreatedByID]; ok {
+				transfer["created_user_name"] = name
+			}
+		}
 
 		// detail
 		transfer["product_id"] = detail.ProductID
@@ -232,7 +336,6 @@ func (s *KiotVietStreaming) basicTransferToRows(basicTransfer kiotviet.TransferB
 			transfer["received_imei_serials"] = webDetail.ReceivedSerialNumbers
 			transfer["barcode"] = webDetail.Product.BarCode
 		}
-		//transfer["created_user_name"] = webTransferDetail.SerialNumbers
 		rows = append(rows, data.Row{Values: transfer})
 	}
 
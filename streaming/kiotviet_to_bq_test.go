@@ -1,7 +1,9 @@
 package streaming
 
 import (
-	"context"
+	biqueryclient "db-sync/clients/bigquery"
+	"db-sync/clients/kiotviet"
+	"db-sync/config"
 	"fmt"
 	"testing"
 
@@ -10,9 +12,35 @@ import (
 
 func TestGenerateQueryKiotViet(t *testing.T) {
 	assert := assert.New(t)
-	ctx := context.Background()
-	s := NewKiotVietStreaming(nil, nil)
-	query, err := s.generateMergeQuery(ctx, "kiotviet_transfers", transfersUpdateColumnNames)
+	dest, err := biqueryclient.NewDestination(config.PipelineKiotViet)
+	assert.Nil(err)
+	s := NewKiotVietStreaming(nil, nil, biqueryclient.NewRun("run-1", dest))
+	query, err := s.mergeStatement("kiotviet_transfers", transfersKeyColumns, transfersUpdateColumnNames).SQL()
 	assert.Nil(err)
 	fmt.Println(query)
 }
+
+func TestBasicTransferToRowsUserName(t *testing.T) {
+	assert := assert.New(t)
+	s := NewKiotVietStreaming(nil, nil, nil)
+	s.addUserNames([]kiotviet.User{{ID: 1, UserName: "admin"}, {ID: 2, UserName: "lan", GivenName: "Nguyen Lan"}})
+
+	createdByID := int64(2)
+	rows := s.basicTransferToRows(kiotviet.TransferBasicInfo{
+		ID:             10,
+		CreatedByID:    &createdByID,
+		TransferDetail: []kiotviet.TransferDetail{{ProductID: 8}},
+	}, nil)
+	assert.Len(rows, 1)
+	assert.Equal(int64(2), rows[0].Values["created_by_id"])
+	assert.Equal("Nguyen Lan", rows[0].Values["created_user_name"])
+
+	unknownID := int64(3)
+	rows = s.basicTransferToRows(kiotviet.TransferBasicInfo{
+		ID:             11,
+		CreatedByID:    &unknownID,
+		TransferDetail: []kiotviet.TransferDetail{{ProductID: 8}},
+	}, nil)
+	assert.NotContains(rows[0].Values, "created_user_name")
+	assert.Equal("admin", s.userNames[1])
+}
@@ -0,0 +1,64 @@
+package streaming
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultInitialLookback is how far back the documents are listed when no watermark was recorded yet
+const DefaultInitialLookback = 60 * 24 * time.Hour
+
+// WatermarkOverlap is listed again before the watermark, for the documents saved while the previous run was listing
+const WatermarkOverlap = 10 * time.Minute
+
+// parseInitialLookback reads KIOTVIET_INITIAL_LOOKBACK_DAYS, an invalid value falls back to DefaultInitialLookback
+func parseInitialLookback(days string) time.Duration {
+	if days == "" {
+		return DefaultInitialLookback
+	}
+	n, err := strconv.Atoi(days)
+	if err != nil || n <= 0 {
+		log.WithFields(log.Fields{
+			"days":    days,
+			"default": DefaultInitialLookback,
+		}).Warnln("invalid KIOTVIET_INITIAL_LOOKBACK_DAYS, using the default")
+		return DefaultInitialLookback
+	}
+	return time.Duration(n) * 24 * time.Hour
+}
+
+// lastModifiedFrom returns the local time of the retailer from which the documents of the table are listed.
+// Incremental runs resume from the watermark of the last succeeded run and record until as the next watermark.
+// The first incremental run and the other runs, e.g. backfills, rescan the lookback before until.
+// The _date partition of an incremental run so only holds the documents modified since the previous run, not a
+// snapshot of the lookback. The <table>_latest view, or the latest function of the models, has the last synced version
+// of every document, with the lines of its latest run for the line tables, see biqueryclient.latestViewQuery
+func (s *KiotVietStreaming) lastModifiedFrom(ctx context.Context, tableName string, until time.Time, incremental bool) time.Time {
+	from := until.Add(-s.initialLookback)
+	if incremental {
+		s.summary.SetWatermark(tableName, until)
+		from = s.resumeFrom(ctx, tableName, from)
+	}
+	return from.In(s.run.Dest.Timezone)
+}
+
+func (s *KiotVietStreaming) resumeFrom(ctx context.Context, tableName string, initial time.Time) time.Time {
+	logEntry := log.WithFields(log.Fields{
+		"tableName": tableName,
+	})
+	watermark, err := s.lastWatermark(ctx, tableName)
+	if err != nil {
+		logEntry.WithField("error", err).Warnln("error reading the watermark, listing the initial lookback")
+		return initial
+	}
+	if watermark.IsZero() {
+		logEntry.Infoln("no watermark yet, listing the initial lookback")
+		return initial
+	}
+
+	logEntry.WithField("watermark", watermark).Infoln("resuming from the watermark")
+	return watermark.Add(-WatermarkOverlap)
+}
@@ -0,0 +1,64 @@
+package streaming
+
+import (
+	"context"
+	biqueryclient "db-sync/clients/bigquery"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseInitialLookback(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(DefaultInitialLookback, parseInitialLookback(""))
+	assert.Equal(7*24*time.Hour, parseInitialLookback("7"))
+	assert.Equal(DefaultInitialLookback, parseInitialLookback("-1"))
+	assert.Equal(DefaultInitialLookback, parseInitialLookback("a week"))
+}
+
+func TestLastModifiedFromNotIncremental(t *testing.T) {
+	assert := assert.New(t)
+	hcm, err := time.LoadLocation("Asia/Ho_Chi_Minh")
+	assert.Nil(err)
+	run := biqueryclient.NewRun("run-1", &biqueryclient.Destination{Dataset: "kiotviet", Timezone: hcm})
+	s := NewKiotVietStreaming(nil, nil, run)
+	s.initialLookback = 7 * 24 * time.Hour
+
+	until := time.Date(2022, 5, 8, 17, 0, 0, 0, time.UTC)
+	from := s.lastModifiedFrom(context.Background(), KiotvietTransferTable, until, false)
+	// KiotViet filters on the local time of the retailer
+	assert.Equal("2022-05-02T00:00:00", from.Format("2006-01-02T15:04:05"))
+	assert.True(s.summary.Table(KiotvietTransferTable).Watermark.IsZero())
+}
+
+func TestLastModifiedFromWatermark(t *testing.T) {
+	assert := assert.New(t)
+	hcm, err := time.LoadLocation("Asia/Ho_Chi_Minh")
+	assert.Nil(err)
+	run := biqueryclient.NewRun("run-1", &biqueryclient.Destination{Dataset: "kiotviet", Timezone: hcm})
+	s := NewKiotVietStreaming(nil, nil, run)
+	s.initialLookback = 7 * 24 * time.Hour
+	until := time.Date(2022, 5, 8, 17, 0, 0, 0, time.UTC)
+
+	watermark := time.Date(2022, 5, 7, 17, 0, 0, 0, time.UTC)
+	s.lastWatermark = func(ctx context.Context, tableName string) (time.Time, error) {
+		assert.Equal(KiotvietTransferTable, tableName)
+		return watermark, nil
+	}
+	from := s.lastModifiedFrom(context.Background(), KiotvietTransferTable, until, true)
+	// the overlap before the watermark is listed again
+	assert.Equal("2022-05-07T23:50:00", from.Format("2006-01-02T15:04:05"))
+	assert.Equal(until, s.summary.Table(KiotvietTransferTable).Watermark)
+
+	// no watermark yet or an error reading it falls back to the initial lookback
+	s.lastWatermark = func(ctx context.Context, tableName string) (time.Time, error) {
+		return time.Time{}, nil
+	}
+	assert.Equal("2022-05-02T00:00:00", s.lastModifiedFrom(context.Background(), KiotvietTransferTable, until, true).Format("2006-01-02T15:04:05"))
+	s.lastWatermark = func(ctx context.Context, tableName string) (time.Time, error) {
+		return time.Time{}, errors.New("table not found")
+	}
+	assert.Equal("2022-05-02T00:00:00", s.lastModifiedFrom(context.Background(), KiotvietTransferTable, until, true).Format("2006-01-02T15:04:05"))
+}
@@ -0,0 +1,279 @@
+package streaming
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	biqueryclient "db-sync/clients/bigquery"
+	"db-sync/clients/kiotviet"
+	"db-sync/config"
+	"db-sync/data"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WebhookSignatureHeader carries the HMAC-SHA256 of the body keyed by the secret of the webhook registration
+const WebhookSignatureHeader = "X-Hub-Signature"
+
+const maxWebhookBodyBytes = 10 << 20
+
+// WebhookTypes are the KiotViet webhooks converted into rows, the other notifications are ignored
+var WebhookTypes = []string{"product.update", "stock.update", "order.update", "invoice.update"}
+
+// webhookTables are the tables written by the webhooks
+var webhookTables = []string{
+	KiotvietProductTable,
+	KiotvietInventoryTable,
+	KiotvietOrderTable,
+	KiotvietInvoiceTable,
+	KiotvietInvoiceDetailTable,
+}
+
+// WebhookReceiver streams the rows of the KiotViet webhook notifications into presync and merges them on an interval.
+// Every merge closes the run of the rows received so far and starts a new one, so a merge only reads the rows
+// received since the previous merge and the rows of a new day land in its partition
+type WebhookReceiver struct {
+	bqClient *biqueryclient.Client
+	dest     *biqueryclient.Destination
+	secret   string
+	// insecure accepts the calls without checking their signature when there is no secret, e.g. to post recorded
+	// payloads locally. Without it and without secret every call is refused
+	insecure bool
+
+	// lock is held for reading while rows are written into the run and for writing to close the run
+	lock      sync.RWMutex
+	streaming *KiotVietStreaming
+	// tables are the tables written in the run
+	tablesLock sync.Mutex
+	tables     map[string]bool
+}
+
+func NewWebhookReceiver(bqClient *biqueryclient.Client, dest *biqueryclient.Destination, secret string, insecure bool) *WebhookReceiver {
+	r := &WebhookReceiver{
+		bqClient: bqClient,
+		dest:     dest,
+		secret:   secret,
+		insecure: insecure,
+	}
+	r.streaming, r.tables = r.newRun()
+	return r
+}
+
+func (r *WebhookReceiver) newRun() (*KiotVietStreaming, map[string]bool) {
+	run := biqueryclient.NewRun(biqueryclient.NewRunID(), r.dest)
+	return NewKiotVietStreaming(r.bqClient, nil, run), make(map[string]bool)
+}
+
+// EnsureTables creates or updates the tables written by the webhooks before receiving them
+func (r *WebhookReceiver) EnsureTables(ctx context.Context) error {
+	var tables []kiotVietTable
+	for _, tableName := range webhookTables {
+		table, _ := findKiotVietTable(tableName)
+		tables = append(tables, table)
+	}
+	return r.streaming.ensureTables(ctx, tables...)
+}
+
+// ServeHTTP accepts a webhook call. KiotViet calls again the webhooks answered with an error
+func (r *WebhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxWebhookBodyBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !r.authorized(body, req.Header.Get(WebhookSignatureHeader)) {
+		log.WithFields(log.Fields{
+			"remoteAddr": req.RemoteAddr,
+		}).Warnln("webhook with an invalid signature")
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	tableRows, err := webhookToRows(body)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Errorln("error converting webhook into rows")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := r.write(req.Context(), tableRows); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Errorln("error streaming webhook rows into presync dataset")
+		http.Error(w, "error streaming rows", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *WebhookReceiver) write(ctx context.Context, tableRows map[string][]data.Row) error {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	tableNames := make([]string, 0, len(tableRows))
+	for tableName := range tableRows {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+	for _, tableName := range tableNames {
+		r.tablesLock.Lock()
+		if !r.tables[tableName] {
+			r.tables[tableName] = true
+			r.streaming.summary.Start(tableName)
+		}
+		r.tablesLock.Unlock()
+
+		if err := r.streaming.writeRows(ctx, tableName, tableRows[tableName]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run merges the rows received every interval until ctx is done, the caller merges the last rows once the handlers drained
+func (r *WebhookReceiver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Merge(ctx)
+		}
+	}
+}
+
+// Merge closes the run, then merges and audits the tables it wrote
+func (r *WebhookReceiver) Merge(ctx context.Context) {
+	r.lock.Lock()
+	s, tables := r.streaming, r.tables
+	r.streaming, r.tables = r.newRun()
+	r.lock.Unlock()
+
+	for _, tableName := range webhookTables {
+		if !tables[tableName] {
+			continue
+		}
+		table, _ := findKiotVietTable(tableName)
+		err := s.mergeTables(ctx, table)
+		auditTable(ctx, r.bqClient, s.run, config.PipelineKiotViet, s.summary.End(tableName, err))
+	}
+	if len(tables) > 0 {
+		s.summary.Log()
+	}
+}
+
+// authorized fails closed: without secret the calls are only accepted by an insecure receiver
+func (r *WebhookReceiver) authorized(body []byte, signature string) bool {
+	if r.secret == "" {
+		return r.insecure
+	}
+	return verifyWebhookSignature(r.secret, body, signature)
+}
+
+// verifyWebhookSignature checks the HMAC-SHA256 of the body keyed by secret. The signature is hex or base64 encoded,
+// optionally prefixed by sha256=. No body is accepted without secret
+func verifyWebhookSignature(secret string, body []byte, signature string) bool {
+	if secret == "" {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+
+	signature = strings.TrimPrefix(strings.TrimSpace(signature), "sha256=")
+	if decoded, err := hex.DecodeString(signature); err == nil && hmac.Equal(decoded, expected) {
+		return true
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(signature); err == nil && hmac.Equal(decoded, expected) {
+		return true
+	}
+	return false
+}
+
+// webhookType strips the retailer id from the action of a notification, e.g. product.update.500123
+func webhookType(action string) string {
+	parts := strings.SplitN(action, ".", 3)
+	if len(parts) < 2 {
+		return action
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// webhookToRows converts the notifications of a webhook call into the rows of the tables they update.
+// The notifications carry the same documents as the public API, with their fields capitalized
+func webhookToRows(body []byte) (map[string][]data.Row, error) {
+	var payload kiotviet.WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %v", err)
+	}
+
+	tableRows := make(map[string][]data.Row)
+	for _, notification := range payload.Notifications {
+		var err error
+		switch webhookType(notification.Action) {
+		case "product.update":
+			var products []kiotviet.Product
+			if err = json.Unmarshal(notification.Data, &products); err == nil {
+				var productRows, inventoryRows []data.Row
+				productRows, inventoryRows, err = productsToRows(products)
+				tableRows[KiotvietProductTable] = append(tableRows[KiotvietProductTable], productRows...)
+				tableRows[KiotvietInventoryTable] = append(tableRows[KiotvietInventoryTable], inventoryRows...)
+			}
+		case "stock.update":
+			var inventories []kiotviet.ProductInventory
+			if err = json.Unmarshal(notification.Data, &inventories); err == nil {
+				for _, i := range inventories {
+					tableRows[KiotvietInventoryTable] = append(tableRows[KiotvietInventoryTable], inventoryToRow(i.ProductID, i))
+				}
+			}
+		case "order.update":
+			var orders []kiotviet.Order
+			if err = json.Unmarshal(notification.Data, &orders); err == nil {
+				for _, order := range orders {
+					tableRows[KiotvietOrderTable] = append(tableRows[KiotvietOrderTable], orderToRows(order)...)
+				}
+			}
+		case "invoice.update":
+			var invoices []kiotviet.Invoice
+			if err = json.Unmarshal(notification.Data, &invoices); err == nil {
+				var invoiceRows, detailRows []data.Row
+				invoiceRows, detailRows, err = invoicesToRows(invoices)
+				tableRows[KiotvietInvoiceTable] = append(tableRows[KiotvietInvoiceTable], invoiceRows...)
+				tableRows[KiotvietInvoiceDetailTable] = append(tableRows[KiotvietInvoiceDetailTable], detailRows...)
+			}
+		default:
+			log.WithFields(log.Fields{
+				"action": notification.Action,
+			}).Infoln("webhook not synced, ignoring it")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s notification: %v", notification.Action, err)
+		}
+	}
+
+	for tableName, rows := range tableRows {
+		if len(rows) == 0 {
+			delete(tableRows, tableName)
+		}
+	}
+	return tableRows, nil
+}
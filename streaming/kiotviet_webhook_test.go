@@ -0,0 +1,110 @@
+package streaming
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookToRows(t *testing.T) {
+	assert := assert.New(t)
+
+	body, err := os.ReadFile("testdata/webhooks/product_update.json")
+	assert.Nil(err)
+	tableRows, err := webhookToRows(body)
+	assert.Nil(err)
+	assert.Len(tableRows[KiotvietProductTable], 1)
+	assert.Equal(int64(8), tableRows[KiotvietProductTable][0].Values["id"])
+	assert.Equal(time.Date(2022, 7, 1, 18, 40, 40, 353000000, time.UTC), tableRows[KiotvietProductTable][0].Values["modified_date"])
+	assert.Len(tableRows[KiotvietInventoryTable], 1)
+
+	body, err = os.ReadFile("testdata/webhooks/stock_update.json")
+	assert.Nil(err)
+	tableRows, err = webhookToRows(body)
+	assert.Nil(err)
+	assert.Len(tableRows, 1)
+	assert.Len(tableRows[KiotvietInventoryTable], 2)
+	assert.Equal(int64(2), tableRows[KiotvietInventoryTable][1].Values["branch_id"])
+	assert.Equal(float64(5), tableRows[KiotvietInventoryTable][1].Values["on_hand"])
+
+	body, err = os.ReadFile("testdata/webhooks/order_update.json")
+	assert.Nil(err)
+	tableRows, err = webhookToRows(body)
+	assert.Nil(err)
+	assert.Len(tableRows[KiotvietOrderTable], 1)
+	assert.Equal(int64(1201), tableRows[KiotvietOrderTable][0].Values["id"])
+	assert.Equal(int64(55), tableRows[KiotvietOrderTable][0].Values["customer_id"])
+
+	// the customer notification is ignored
+	body, err = os.ReadFile("testdata/webhooks/invoice_update.json")
+	assert.Nil(err)
+	tableRows, err = webhookToRows(body)
+	assert.Nil(err)
+	assert.Len(tableRows, 2)
+	assert.Len(tableRows[KiotvietInvoiceTable], 1)
+	assert.Contains(tableRows[KiotvietInvoiceTable][0].Values["payments"], `"amount":240000`)
+	assert.Len(tableRows[KiotvietInvoiceDetailTable], 2)
+	assert.Equal(2, tableRows[KiotvietInvoiceDetailTable][1].Values["_sub_id"])
+
+	_, err = webhookToRows([]byte(`{"Notifications": [{"Action": "stock.update.500123", "Data": {}}]}`))
+	assert.NotNil(err)
+	_, err = webhookToRows([]byte(`not json`))
+	assert.NotNil(err)
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	assert := assert.New(t)
+	body := []byte(`{"Notifications": []}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	sum := mac.Sum(nil)
+
+	assert.True(verifyWebhookSignature("secret", body, hex.EncodeToString(sum)))
+	assert.True(verifyWebhookSignature("secret", body, "sha256="+hex.EncodeToString(sum)))
+	assert.True(verifyWebhookSignature("secret", body, base64.StdEncoding.EncodeToString(sum)))
+	assert.False(verifyWebhookSignature("secret", body, ""))
+	assert.False(verifyWebhookSignature("other", body, hex.EncodeToString(sum)))
+	assert.False(verifyWebhookSignature("", body, ""))
+}
+
+func TestWebhookReceiverServeHTTP(t *testing.T) {
+	assert := assert.New(t)
+	r := &WebhookReceiver{secret: "secret", tables: make(map[string]bool)}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/kiotviet/webhook", nil))
+	assert.Equal(http.StatusMethodNotAllowed, w.Code)
+
+	body := `{"Notifications": []}`
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/kiotviet/webhook", strings.NewReader(body)))
+	assert.Equal(http.StatusUnauthorized, w.Code)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(body))
+	req := httptest.NewRequest(http.MethodPost, "/kiotviet/webhook", strings.NewReader(body))
+	req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Empty(r.tables)
+
+	// without secret the calls are refused unless the receiver is insecure
+	r = &WebhookReceiver{tables: make(map[string]bool)}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/kiotviet/webhook", strings.NewReader(body)))
+	assert.Equal(http.StatusUnauthorized, w.Code)
+	r.insecure = true
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/kiotviet/webhook", strings.NewReader(body)))
+	assert.Equal(http.StatusOK, w.Code)
+}
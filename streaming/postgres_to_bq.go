@@ -5,136 +5,198 @@ import (
 	bigqueryclient "db-sync/clients/bigquery"
 	"db-sync/clients/webdatabases"
 	"db-sync/config"
-	"db-sync/helpers"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"strings"
 	"sync"
 )
 
+// webDBKeyColumns is the primary key of the web database tables
+var webDBKeyColumns = []string{"id"}
+
 type webDBToBQStreaming struct {
 	bqClient    *bigqueryclient.Client
 	webDBClient *webdatabases.Client
+	run         *bigqueryclient.Run
 	batchSize   int64
 	tables      []string
 	guardSize   int
+	summary     *RunSummary
+	validate    bool
 }
 
-func NewWebDBToBQStreaming(bqClient *bigqueryclient.Client, webDBClient *webdatabases.Client, batchSize int64, tables []string) *webDBToBQStreaming {
+func NewWebDBToBQStreaming(bqClient *bigqueryclient.Client, webDBClient *webdatabases.Client, run *bigqueryclient.Run, batchSize int64, tables []string) *webDBToBQStreaming {
 	return &webDBToBQStreaming{
 		bqClient:    bqClient,
 		webDBClient: webDBClient,
+		run:         run,
 		batchSize:   batchSize,
 		tables:      tables,
 		guardSize:   5,
+		summary:     NewRunSummary(),
+		validate:    config.SyncValidate,
 	}
 }
 
+func (s *webDBToBQStreaming) Summary() *RunSummary {
+	return s.summary
+}
+
 func (s *webDBToBQStreaming) Stream(ctx context.Context) error {
 	for _, tableName := range s.tables {
-		err := s.streamTable(ctx, tableName)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"tableName": tableName,
-				"error":     err,
-			}).Errorln("error streaming table into presync dataset in BQ")
-			continue
-		}
+		// errors are logged by StreamTable, a failing table doesn't stop the others
+		_ = s.StreamTable(ctx, tableName)
+	}
+
+	return nil
+}
+
+// StreamTable ensures, streams, merges and optionally validates one table, then audits the run of the table
+func (s *webDBToBQStreaming) StreamTable(ctx context.Context, tableName string) error {
+	bqTableName := strings.ToLower(tableName)
+	s.summary.Start(bqTableName)
+	err := s.syncTable(ctx, tableName)
+	auditTable(ctx, s.bqClient, s.run, config.PipelineWebDB, s.summary.End(bqTableName, err))
+	return err
+}
+
+func (s *webDBToBQStreaming) syncTable(ctx context.Context, tableName string) error {
+	err := s.ensureTable(ctx, tableName)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"tableName": tableName,
+			"error":     err,
+		}).Errorln("error ensuring table in BQ")
+		return err
+	}
+
+	err = s.streamTable(ctx, tableName)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"tableName": tableName,
+			"error":     err,
+		}).Errorln("error streaming table into presync dataset in BQ")
+		return err
+	}
+
+	err = s.mergeTable(ctx, tableName)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"tableName": tableName,
+			"error":     err,
+		}).Errorln("error merging table from presync dataset to web-sync in BQ")
+		return err
+	}
 
-		err = s.mergeTable(ctx, tableName)
+	if s.validate && !s.run.DryRun {
+		err = s.validateTable(ctx, tableName)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"tableName": tableName,
 				"error":     err,
-			}).Errorln("error merging table from presync dataset to web-sync in BQ")
+			}).Errorln("error validating table in BQ against web database")
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (s *webDBToBQStreaming) mergeTable(ctx context.Context, tableName string) error {
-	log.WithFields(log.Fields{
-		"tableName": tableName,
-	}).Infoln("start merging table from presync dataset to web-sync dataset in Biqquery")
-	query, err := s.generateMergeQuery(ctx, tableName)
+// ensureTable creates the websync and presync tables if needed and adds the columns the web team added in Postgres
+// before streaming, otherwise the new columns are dropped on insert and the merge fails.
+// The _latest view of the table is regenerated along with the schema
+func (s *webDBToBQStreaming) ensureTable(ctx context.Context, tableName string) error {
+	columns, err := s.webDBClient.GetTableInfo(ctx, tableName)
 	if err != nil {
 		return err
 	}
 
-	q := s.bqClient.Query(query)
-	q.Location = "US"
-	job, err := q.Run(ctx)
+	bqTableName := strings.ToLower(tableName)
+	report, err := s.bqClient.EnsureSyncTimePartitionTable(ctx, s.run.Dest, bqTableName, columns)
+	if report != nil {
+		report.Log()
+	}
 	if err != nil {
 		return err
 	}
-	status, err := job.Wait(ctx)
+
+	ensureLatestView(ctx, s.bqClient, s.run.Dest, bqTableName, webDBKeyColumns, columns)
+	return nil
+}
+
+func (s *webDBToBQStreaming) mergeTable(ctx context.Context, tableName string) error {
+	log.WithFields(log.Fields{
+		"tableName": tableName,
+	}).Infoln("start merging table from presync dataset to web-sync dataset in Biqquery")
+	stmt, err := s.mergeStatement(ctx, tableName)
 	if err != nil {
 		return err
 	}
 
-	if err := status.Err(); err != nil {
+	cost, err := s.bqClient.RunMerge(ctx, s.run, stmt)
+	if cost != nil {
+		s.summary.AddMergeCost(strings.ToLower(tableName), cost)
+	}
+	if err != nil {
 		return err
 	}
+	if !cost.Executed {
+		return nil
+	}
+
 	log.WithFields(log.Fields{
 		"tableName": tableName,
 	}).Infoln("done merging table from presync dataset to web-sync dataset in Biqquery")
 	return nil
 }
 
-func (s *webDBToBQStreaming) generateMergeQuery(ctx context.Context, tableName string) (string, error) {
-	temp := `
-		MERGE {{.tableName}} T
-			USING (SELECT
-			agg.table.*
-			FROM (
-			SELECT
-			id,
-			ARRAY_AGG(STRUCT(table)
-			ORDER BY
-			_created_at DESC)[SAFE_OFFSET(0)] agg
-			FROM
-			{{.presyncTableName}} table
-			WHERE
-			{{.whereClause}}
-			GROUP BY
-			id, _date)) S
-			ON T.id = S.id and T._date = S._date
-			WHEN MATCHED THEN
-		UPDATE SET {{.updateClause}}
-			WHEN NOT MATCHED THEN
-		INSERT {{.insertFieldClause}} VALUES {{.insertValueClause}}
-		`
-
+// mergeStatement merges the rows of the run with the merge strategy of the table options
+func (s *webDBToBQStreaming) mergeStatement(ctx context.Context, tableName string) (bigqueryclient.MergeStatement, error) {
 	columns, err := s.webDBClient.GetTableInfo(ctx, tableName)
 	if err != nil {
-		return "", err
+		return bigqueryclient.MergeStatement{}, err
 	}
-	var updateColumnNames []string
-	var updateItems []string
+	var columnNames []string
 	for _, c := range columns {
-		updateColumnNames = append(updateColumnNames, c.Name)
+		columnNames = append(columnNames, c.Name)
 	}
-	for _, c := range updateColumnNames {
-		updateItems = append(updateItems, fmt.Sprintf("%s = S.%s", c, c))
+
+	return s.run.MergeStatement(tableName, webDBKeyColumns, columnNames), nil
+}
+
+// validateTable compares the row count and the checksums of the Postgres table with the rows synced into BigQuery
+// by the run. The table is marked as failed in the summary when they diverge
+func (s *webDBToBQStreaming) validateTable(ctx context.Context, tableName string) error {
+	columns, err := s.webDBClient.GetTableInfo(ctx, tableName)
+	if err != nil {
+		return err
 	}
 
-	insertColumnName := append(updateColumnNames, "_date")
-	insertFieldClause := fmt.Sprintf("(%s)", strings.Join(insertColumnName, ","))
-	insertValueClause := insertFieldClause
-	updateClause := strings.Join(updateItems, ",")
+	sourceChecksum, err := s.webDBClient.GetChecksum(ctx, tableName, columns, webDBKeyColumns)
+	if err != nil {
+		return err
+	}
+	bqChecksum, err := s.bqClient.GetChecksum(ctx, s.run, tableName, columns, webDBKeyColumns)
+	if err != nil {
+		return err
+	}
 
 	bqTableName := strings.ToLower(tableName)
-	variables := map[string]interface{}{
-		"tableName":         fmt.Sprintf("`%s.%s`", config.BqWebsyncDataset, bqTableName),
-		"presyncTableName":  fmt.Sprintf("`%s.%s`", config.BqPresyncDataset, bqTableName),
-		"updateClause":      updateClause,
-		"insertFieldClause": insertFieldClause,
-		"insertValueClause": insertValueClause,
-		"whereClause":       `_date = CURRENT_DATE("+7")`,
+	deltas := sourceChecksum.Diff(bqChecksum)
+	s.summary.SetValidation(bqTableName, deltas)
+	if len(deltas) > 0 {
+		var items []string
+		for _, delta := range deltas {
+			items = append(items, delta.String())
+		}
+		return fmt.Errorf("table diverges from web database: %s", strings.Join(items, ", "))
 	}
 
-	return helpers.MakeTemplateFile(temp, variables)
+	log.WithFields(log.Fields{
+		"tableName": bqTableName,
+		"rows":      bqChecksum.Rows,
+	}).Infoln("table matches web database")
+	return nil
 }
 
 func (s *webDBToBQStreaming) streamTable(ctx context.Context, originalTableName string) error {
@@ -153,6 +215,7 @@ func (s *webDBToBQStreaming) streamTable(ctx context.Context, originalTableName
 		wg.Add(1)
 		go func(n int) {
 			defer wg.Done()
+			defer func() { <-guard }()
 			log.WithFields(log.Fields{
 				"tableName":   bqTableName,
 				"batchNumber": n,
@@ -165,32 +228,39 @@ func (s *webDBToBQStreaming) streamTable(ctx context.Context, originalTableName
 					"offset":    offset,
 					"error":     err,
 				}).Errorln("error getting rows from database")
+				s.summary.AddBatch(bqTableName, 0, nil)
 				return
 			}
 
-			err = s.bqClient.InsertOrUpdate(ctx, config.BqPresyncDataset, bqTableName, rows)
+			result, err := s.bqClient.Write(ctx, s.run, bqTableName, rows)
 			if err != nil {
 				log.WithFields(log.Fields{
 					"tableName": bqTableName,
 					"offset":    offset,
 					"error":     err,
 				}).Errorln("error inserting rows into Bigquery")
+				s.summary.AddBatch(bqTableName, len(rows.Rows), nil)
 				return
 			}
+			s.summary.AddBatch(bqTableName, len(rows.Rows), result)
 
 			log.WithFields(log.Fields{
 				"tableName":   bqTableName,
 				"offset":      offset,
 				"batchNumber": n,
 			}).Infoln("done inserting a batch rows into Bigquery")
-			<-guard
 		}(i)
 	}
 
 	wg.Wait()
-	log.WithFields(log.Fields{
-		"BQTableName":  fmt.Sprintf("%s.%s", config.BqPresyncDataset, bqTableName),
+	logEntry := log.WithFields(log.Fields{
+		"BQTableName":  fmt.Sprintf("%s.%s", s.run.Dest.PresyncDataset, bqTableName),
 		"WebTableName": originalTableName,
-	}).Infoln("successfully streaming table from web databases to BigQuery")
+	})
+	// a partial presync table is not merged, the table is reported failed instead
+	if summary := s.summary.Table(bqTableName); summary.FailedBatches > 0 {
+		return fmt.Errorf("%d batches failed", summary.FailedBatches)
+	}
+	logEntry.Infoln("successfully streaming table from web databases to BigQuery")
 	return nil
 }
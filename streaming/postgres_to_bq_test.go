@@ -4,6 +4,7 @@ import (
 	"context"
 	bigqueryclient "db-sync/clients/bigquery"
 	"db-sync/clients/webdatabases"
+	"db-sync/config"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -27,8 +28,12 @@ func TestGenerateQuery(t *testing.T) {
 	}
 	defer bqClient.Close()
 
-	streamingService := NewWebDBToBQStreaming(bqClient, dbClient, 0, nil)
-	query, err := streamingService.generateMergeQuery(ctx, "POptions")
+	dest, err := bigqueryclient.NewDestination(config.PipelineWebDB)
+	assertor.Nil(err)
+	streamingService := NewWebDBToBQStreaming(bqClient, dbClient, bigqueryclient.NewRun("run-1", dest), 0, nil)
+	stmt, err := streamingService.mergeStatement(ctx, "POptions")
+	assertor.Nil(err)
+	query, err := stmt.SQL()
 	assertor.Nil(err)
 	fmt.Println(query)
 }
@@ -0,0 +1,237 @@
+package streaming
+
+import (
+	"context"
+	biqueryclient "db-sync/clients/bigquery"
+	"db-sync/clients/webdatabases"
+	"db-sync/data"
+	"fmt"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/civil"
+	log "github.com/sirupsen/logrus"
+)
+
+// DeadLetterReplay re-sends dead-lettered rows into their presync table and merges the affected tables again.
+// The rows are replayed into the _date partition of the run which rejected them
+type DeadLetterReplay struct {
+	bqClient *biqueryclient.Client
+	// webDBClient is only needed to replay the rows of Postgres tables
+	webDBClient  *webdatabases.Client
+	webDBDest    *biqueryclient.Destination
+	kiotVietDest *biqueryclient.Destination
+	batchSize    int64
+	tables       []string
+	runID        string
+	// convert re-applies the current type conversion to the rows before inserting them
+	convert bool
+	summary *RunSummary
+}
+
+func NewDeadLetterReplay(bqClient *biqueryclient.Client, webDBClient *webdatabases.Client, webDBDest *biqueryclient.Destination, kiotVietDest *biqueryclient.Destination, batchSize int64, tables []string, runID string, convert bool) *DeadLetterReplay {
+	return &DeadLetterReplay{
+		bqClient:     bqClient,
+		webDBClient:  webDBClient,
+		webDBDest:    webDBDest,
+		kiotVietDest: kiotVietDest,
+		batchSize:    batchSize,
+		tables:       tables,
+		runID:        runID,
+		convert:      convert,
+		summary:      NewRunSummary(),
+	}
+}
+
+func (r *DeadLetterReplay) Summary() *RunSummary {
+	return r.summary
+}
+
+// NeedsWebDB tells if replaying the records merges Postgres tables, which reads their columns from Postgres
+func NeedsWebDB(records []biqueryclient.DeadLetterRecord) bool {
+	for _, record := range records {
+		if _, ok := findKiotVietTable(record.Table); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Replay replays the records and returns the ones replayed, the records of the failed tables and dates are left out
+func (r *DeadLetterReplay) Replay(ctx context.Context, records []biqueryclient.DeadLetterRecord) ([]biqueryclient.DeadLetterRecord, error) {
+	tableToRecords := make(map[string][]biqueryclient.DeadLetterRecord)
+	var tables []string
+	for _, record := range records {
+		if _, ok := tableToRecords[record.Table]; !ok {
+			tables = append(tables, record.Table)
+		}
+		tableToRecords[record.Table] = append(tableToRecords[record.Table], record)
+	}
+
+	var replayed []biqueryclient.DeadLetterRecord
+	var failedTables []string
+	for _, tableName := range tables {
+		tableReplayed, err := r.replayTable(ctx, tableName, tableToRecords[tableName])
+		replayed = append(replayed, tableReplayed...)
+		if err != nil {
+			failedTables = append(failedTables, tableName)
+		}
+	}
+
+	if len(failedTables) > 0 {
+		return replayed, fmt.Errorf("error replaying dead-lettered rows of tables %s", strings.Join(failedTables, ","))
+	}
+	return replayed, nil
+}
+
+// replayTable replays the records of the table one sync date after the other, oldest first
+func (r *DeadLetterReplay) replayTable(ctx context.Context, tableName string, records []biqueryclient.DeadLetterRecord) ([]biqueryclient.DeadLetterRecord, error) {
+	dest, err := r.destination(tableName)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"tableName": tableName,
+			"error":     err,
+		}).Errorln("error replaying dead-lettered rows")
+		return nil, err
+	}
+
+	dateToRecords := make(map[civil.Date][]biqueryclient.DeadLetterRecord)
+	var dates []civil.Date
+	for _, record := range records {
+		date := record.SyncDate
+		// the records written before the sync date was recorded were rejected the day of their run
+		if date.IsZero() {
+			date = civil.DateOf(record.RejectedAt.In(dest.Timezone))
+		}
+		if _, ok := dateToRecords[date]; !ok {
+			dates = append(dates, date)
+		}
+		dateToRecords[date] = append(dateToRecords[date], record)
+	}
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+
+	var replayed []biqueryclient.DeadLetterRecord
+	var failed bool
+	for _, date := range dates {
+		logEntry := log.WithFields(log.Fields{
+			"tableName": tableName,
+			"date":      date,
+			"rows":      len(dateToRecords[date]),
+		})
+
+		err := r.replayPartition(ctx, dest, tableName, date, dateToRecords[date])
+		if err != nil {
+			logEntry.WithField("error", err).Errorln("error replaying dead-lettered rows")
+			failed = true
+			continue
+		}
+		replayed = append(replayed, dateToRecords[date]...)
+		logEntry.Infoln("done replaying dead-lettered rows")
+	}
+
+	if failed {
+		return replayed, fmt.Errorf("error replaying dead-lettered rows of %s", tableName)
+	}
+	return replayed, nil
+}
+
+func (r *DeadLetterReplay) replayPartition(ctx context.Context, dest *biqueryclient.Destination, tableName string, date civil.Date, records []biqueryclient.DeadLetterRecord) error {
+	// presync partitions older than the presync expiration can't be written, such rows can't be replayed
+	run, err := biqueryclient.NewBackfillRun(r.runID, dest, date)
+	if err != nil {
+		return err
+	}
+	merge, err := r.merge(run, tableName)
+	if err != nil {
+		return err
+	}
+
+	var rows []data.Row
+	for _, record := range records {
+		rows = append(rows, data.Row{Values: record.Row})
+	}
+	if r.convert {
+		if err := r.convertRows(ctx, run.Dest, tableName, rows); err != nil {
+			return err
+		}
+	}
+
+	result, err := r.bqClient.Write(ctx, run, tableName, &data.Rows{Rows: rows})
+	if err != nil {
+		r.summary.AddBatch(tableName, len(rows), nil)
+		return err
+	}
+	r.summary.AddBatch(tableName, len(rows), result)
+
+	return merge(ctx)
+}
+
+// convertRows converts the JSON values of the rows into the Go types of the current presync table schema
+func (r *DeadLetterReplay) convertRows(ctx context.Context, dest *biqueryclient.Destination, tableName string, rows []data.Row) error {
+	metadata, err := r.bqClient.Dataset(dest.PresyncDataset).Table(tableName).Metadata(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		for _, field := range metadata.Schema {
+			value, ok := row.Values[field.Name]
+			if !ok {
+				continue
+			}
+			converted, err := data.ConvertValue(field.Type, value)
+			if err != nil {
+				return err
+			}
+			row.Values[field.Name] = converted
+		}
+	}
+	return nil
+}
+
+// destination returns the destination of the pipeline streaming the table
+func (r *DeadLetterReplay) destination(tableName string) (*biqueryclient.Destination, error) {
+	if _, ok := findKiotVietTable(tableName); ok {
+		return r.kiotVietDest, nil
+	}
+	if _, ok := r.originalTableName(tableName); ok {
+		return r.webDBDest, nil
+	}
+	return nil, fmt.Errorf("table %s is not streamed, cannot replay it", tableName)
+}
+
+// merge returns the function merging the rows of the run into the table
+func (r *DeadLetterReplay) merge(run *biqueryclient.Run, tableName string) (func(ctx context.Context) error, error) {
+	if table, ok := findKiotVietTable(tableName); ok {
+		// the KiotViet merges only need the table registry, not the API
+		s := NewKiotVietStreaming(r.bqClient, nil, run)
+		return func(ctx context.Context) error {
+			return s.mergeTables(ctx, table)
+		}, nil
+	}
+
+	originalTableName, ok := r.originalTableName(tableName)
+	if !ok {
+		return nil, fmt.Errorf("table %s is not streamed, cannot replay it", tableName)
+	}
+	if r.webDBClient == nil {
+		return nil, fmt.Errorf("table %s is a Postgres table, replaying it needs Postgres", tableName)
+	}
+	s := NewWebDBToBQStreaming(r.bqClient, r.webDBClient, run, r.batchSize, []string{originalTableName})
+	return func(ctx context.Context) error {
+		return s.mergeTable(ctx, originalTableName)
+	}, nil
+}
+
+// originalTableName returns the name of the table in Postgres, Postgres table names are case sensitive while
+// BigQuery tables are lower cased
+func (r *DeadLetterReplay) originalTableName(tableName string) (string, bool) {
+	for _, originalTableName := range r.tables {
+		if strings.ToLower(originalTableName) == tableName {
+			return originalTableName, true
+		}
+	}
+	return "", false
+}
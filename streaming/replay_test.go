@@ -0,0 +1,33 @@
+package streaming
+
+import (
+	biqueryclient "db-sync/clients/bigquery"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetterReplayDestination(t *testing.T) {
+	assert := assert.New(t)
+	webDBDest := &biqueryclient.Destination{Dataset: "web_sync"}
+	kiotVietDest := &biqueryclient.Destination{Dataset: "kiotviet_sync"}
+	r := NewDeadLetterReplay(nil, nil, webDBDest, kiotVietDest, 100, []string{"Products"}, "run-1", false)
+
+	dest, err := r.destination(KiotvietProductTable)
+	assert.Nil(err)
+	assert.Equal(kiotVietDest, dest)
+	dest, err = r.destination("products")
+	assert.Nil(err)
+	assert.Equal(webDBDest, dest)
+	_, err = r.destination("orders")
+	assert.NotNil(err)
+
+	// without Postgres only the KiotViet tables are replayed
+	_, err = r.merge(&biqueryclient.Run{Dest: kiotVietDest}, KiotvietProductTable)
+	assert.Nil(err)
+	_, err = r.merge(&biqueryclient.Run{Dest: webDBDest}, "products")
+	assert.NotNil(err)
+
+	assert.False(NeedsWebDB([]biqueryclient.DeadLetterRecord{{Table: KiotvietProductTable}}))
+	assert.True(NeedsWebDB([]biqueryclient.DeadLetterRecord{{Table: KiotvietProductTable}, {Table: "products"}}))
+}
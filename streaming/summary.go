@@ -0,0 +1,198 @@
+package streaming
+
+import (
+	biqueryclient "db-sync/clients/bigquery"
+	"db-sync/data"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TableSummary counts what a run did for one table
+type TableSummary struct {
+	Table         string
+	RowsRead      int64
+	RowsWritten   int64
+	RowsRejected  int64
+	FailedBatches int64
+	// MergeBytesProcessed is the dry run estimate of the merge, MergeBytesBilled what the merge job was billed
+	MergeBytesProcessed int64
+	MergeBytesBilled    int64
+	Merged              bool
+	// Validated is true when the table was compared with the source, ValidationDeltas lists the differences
+	Validated        bool
+	ValidationDeltas []string
+	StartedAt        time.Time
+	EndedAt          time.Time
+	MergeJobID       string
+	Error            string
+	// Watermark is where the next incremental run of the table resumes from, zero for full scans
+	Watermark time.Time
+}
+
+// Failed is true when rows are missing or the table diverges from the source
+func (t TableSummary) Failed() bool {
+	return t.RowsRejected > 0 || t.FailedBatches > 0 || len(t.ValidationDeltas) > 0
+}
+
+// RunSummary collects the TableSummary of every table streamed in a run. It is safe for concurrent use
+type RunSummary struct {
+	lock   sync.Mutex
+	tables map[string]*TableSummary
+	order  []string
+}
+
+func NewRunSummary() *RunSummary {
+	return &RunSummary{
+		tables: make(map[string]*TableSummary),
+	}
+}
+
+func (s *RunSummary) table(tableName string) *TableSummary {
+	summary, ok := s.tables[tableName]
+	if !ok {
+		summary = &TableSummary{Table: tableName}
+		s.tables[tableName] = summary
+		s.order = append(s.order, tableName)
+	}
+	return summary
+}
+
+// AddBatch records a batch of rowsRead rows read from the source and the result of writing it into BigQuery.
+// A nil result means the batch failed
+func (s *RunSummary) AddBatch(tableName string, rowsRead int, result *biqueryclient.WriteResult) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	summary := s.table(tableName)
+	summary.RowsRead += int64(rowsRead)
+	if result == nil {
+		summary.FailedBatches++
+		return
+	}
+	summary.RowsWritten += result.Written
+	summary.RowsRejected += result.Rejected
+}
+
+// AddMergeCost records the cost of merging the table, estimated only in dry runs
+func (s *RunSummary) AddMergeCost(tableName string, cost *biqueryclient.MergeCost) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	summary := s.table(tableName)
+	summary.MergeBytesProcessed += cost.BytesProcessed
+	summary.MergeBytesBilled += cost.BytesBilled
+	summary.Merged = summary.Merged || cost.Executed
+	if cost.JobID != "" {
+		summary.MergeJobID = cost.JobID
+	}
+}
+
+// Start records when the run started syncing the table
+func (s *RunSummary) Start(tableName string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.table(tableName).StartedAt = time.Now()
+}
+
+// End records when the run finished syncing the table and the error which stopped it
+func (s *RunSummary) End(tableName string, err error) TableSummary {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	summary := s.table(tableName)
+	summary.EndedAt = time.Now()
+	summary.Error = ""
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	return *summary
+}
+
+// SetValidation records the result of the comparison of the table with its source
+func (s *RunSummary) SetValidation(tableName string, deltas []data.ChecksumDelta) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	summary := s.table(tableName)
+	summary.Validated = true
+	summary.ValidationDeltas = nil
+	for _, delta := range deltas {
+		summary.ValidationDeltas = append(summary.ValidationDeltas, delta.String())
+	}
+}
+
+// SetWatermark records where the next incremental run of the table resumes from if this run succeeds
+func (s *RunSummary) SetWatermark(tableName string, watermark time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.table(tableName).Watermark = watermark
+}
+
+// add accumulates the summary of a table from another run, e.g. the runs of a backfill
+func (s *RunSummary) add(other TableSummary) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	summary := s.table(other.Table)
+	summary.RowsRead += other.RowsRead
+	summary.RowsWritten += other.RowsWritten
+	summary.RowsRejected += other.RowsRejected
+	summary.FailedBatches += other.FailedBatches
+	summary.MergeBytesProcessed += other.MergeBytesProcessed
+	summary.MergeBytesBilled += other.MergeBytesBilled
+	summary.Merged = summary.Merged || other.Merged
+	summary.Validated = summary.Validated || other.Validated
+	summary.ValidationDeltas = append(summary.ValidationDeltas, other.ValidationDeltas...)
+	if summary.StartedAt.IsZero() {
+		summary.StartedAt = other.StartedAt
+	}
+	summary.EndedAt = other.EndedAt
+	summary.MergeJobID = other.MergeJobID
+	summary.Error = other.Error
+}
+
+// Table returns the summary of a table so far
+func (s *RunSummary) Table(tableName string) TableSummary {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return *s.table(tableName)
+}
+
+func (s *RunSummary) Tables() []TableSummary {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var tables []TableSummary
+	for _, tableName := range s.order {
+		tables = append(tables, *s.tables[tableName])
+	}
+	return tables
+}
+
+func (s *RunSummary) Log() {
+	for _, summary := range s.Tables() {
+		logEntry := log.WithFields(log.Fields{
+			"tableName":           summary.Table,
+			"rowsRead":            summary.RowsRead,
+			"rowsWritten":         summary.RowsWritten,
+			"rowsRejected":        summary.RowsRejected,
+			"failedBatches":       summary.FailedBatches,
+			"mergeBytesProcessed": summary.MergeBytesProcessed,
+			"mergeBytesBilled":    summary.MergeBytesBilled,
+			"merged":              summary.Merged,
+			"validated":           summary.Validated,
+			"validationDeltas":    summary.ValidationDeltas,
+			"error":               summary.Error,
+		})
+		if summary.Failed() || summary.Error != "" {
+			logEntry.Warnln("run summary")
+		} else {
+			logEntry.Infoln("run summary")
+		}
+	}
+}
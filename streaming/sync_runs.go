@@ -0,0 +1,49 @@
+package streaming
+
+import (
+	"context"
+	biqueryclient "db-sync/clients/bigquery"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// auditTable writes what the run did for the table into the _sync_runs table. Failing to audit doesn't fail the sync
+func auditTable(ctx context.Context, bqClient *biqueryclient.Client, run *biqueryclient.Run, source string, summary TableSummary) {
+	record := syncRunRecord(run, source, summary)
+	if err := bqClient.WriteSyncRun(ctx, run, record); err != nil {
+		log.WithFields(log.Fields{
+			"tableName": summary.Table,
+			"runID":     run.ID,
+			"error":     err,
+		}).Warnln("error writing sync run record into Bigquery")
+	}
+}
+
+func syncRunRecord(run *biqueryclient.Run, source string, summary TableSummary) biqueryclient.SyncRunRecord {
+	status := biqueryclient.SyncRunSucceeded
+	if summary.Error != "" {
+		status = biqueryclient.SyncRunFailed
+	} else if run.DryRun {
+		status = biqueryclient.SyncRunDryRun
+	} else if summary.Failed() {
+		status = biqueryclient.SyncRunPartial
+	}
+
+	return biqueryclient.SyncRunRecord{
+		RunID:          run.ID,
+		Source:         source,
+		Table:          summary.Table,
+		SyncDate:       run.SyncDate,
+		StartedAt:      summary.StartedAt,
+		EndedAt:        summary.EndedAt,
+		RowsRead:       summary.RowsRead,
+		RowsWritten:    summary.RowsWritten,
+		RowsRejected:   summary.RowsRejected,
+		MergeJobID:     summary.MergeJobID,
+		BytesProcessed: summary.MergeBytesProcessed,
+		BytesBilled:    summary.MergeBytesBilled,
+		Status:         status,
+		Error:          summary.Error,
+		Watermark:      summary.Watermark,
+	}
+}
@@ -0,0 +1,50 @@
+package streaming
+
+import (
+	biqueryclient "db-sync/clients/bigquery"
+	"db-sync/config"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncRunRecord(t *testing.T) {
+	assert := assert.New(t)
+	run := biqueryclient.NewRun("run-1", &biqueryclient.Destination{Dataset: "websync", Timezone: time.UTC})
+	summary := NewRunSummary()
+	summary.Start("products")
+	summary.AddBatch("products", 10, &biqueryclient.WriteResult{Written: 10})
+	summary.AddMergeCost("products", &biqueryclient.MergeCost{JobID: "job-1", BytesProcessed: 100, BytesBilled: 10485760, Executed: true})
+
+	record := syncRunRecord(run, config.PipelineWebDB, summary.End("products", nil))
+	assert.Equal("run-1", record.RunID)
+	assert.Equal(config.PipelineWebDB, record.Source)
+	assert.Equal("products", record.Table)
+	assert.Equal(run.SyncDate, record.SyncDate)
+	assert.Equal(int64(10), record.RowsRead)
+	assert.Equal(int64(10), record.RowsWritten)
+	assert.Equal("job-1", record.MergeJobID)
+	assert.Equal(int64(100), record.BytesProcessed)
+	assert.Equal(biqueryclient.SyncRunSucceeded, record.Status)
+	assert.False(record.EndedAt.Before(record.StartedAt))
+	assert.True(record.Watermark.IsZero())
+
+	watermark := time.Date(2022, 5, 1, 3, 0, 0, 0, time.UTC)
+	summary.SetWatermark("products", watermark)
+	record = syncRunRecord(run, config.PipelineWebDB, summary.End("products", nil))
+	assert.Equal(watermark, record.Watermark)
+
+	summary.AddBatch("products", 5, nil)
+	record = syncRunRecord(run, config.PipelineWebDB, summary.End("products", nil))
+	assert.Equal(biqueryclient.SyncRunPartial, record.Status)
+
+	record = syncRunRecord(run, config.PipelineWebDB, summary.End("products", errors.New("merge failed")))
+	assert.Equal(biqueryclient.SyncRunFailed, record.Status)
+	assert.Equal("merge failed", record.Error)
+
+	run.DryRun = true
+	record = syncRunRecord(run, config.PipelineWebDB, summary.End("orders", nil))
+	assert.Equal(biqueryclient.SyncRunDryRun, record.Status)
+}
@@ -0,0 +1,23 @@
+package streaming
+
+import (
+	"context"
+	biqueryclient "db-sync/clients/bigquery"
+	"db-sync/data"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ensureLatestView keeps the _latest view of the table in line with its schema. The view is a convenience
+// for analysts, failing to maintain it doesn't fail the sync
+func ensureLatestView(ctx context.Context, bqClient *biqueryclient.Client, dest *biqueryclient.Destination, tableName string, keyColumns []string, columns []data.Column) {
+	report, err := bqClient.EnsureLatestView(ctx, dest, tableName, keyColumns, columns)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"tableName": tableName,
+			"error":     err,
+		}).Errorln("error ensuring latest view in BQ")
+		return
+	}
+	report.Log()
+}